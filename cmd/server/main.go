@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+	"github.com/scottlepp/tempo-mcp-server/internal/eventstore"
 	"github.com/scottlepp/tempo-mcp-server/internal/handlers"
 )
 
@@ -14,13 +22,64 @@ const (
 	version = "0.1.0"
 )
 
+// Environment variables controlling how the server is exposed
+const (
+	EnvTransport       = "MCP_TRANSPORT"
+	EnvSSEPort         = "SSE_PORT"
+	EnvSSEBaseURL      = "SSE_BASE_URL"
+	EnvHTTPPort        = "HTTP_PORT"
+	EnvHTTPStateless   = "HTTP_STATELESS"
+	EnvHTTPHeartbeat   = "HTTP_HEARTBEAT_INTERVAL"
+	EnvHTTPRetention   = "HTTP_EVENT_RETENTION"
+	EnvStdioWorkerPool = "STDIO_WORKER_POOL_SIZE"
+)
+
+// Supported transport modes. MCP_TRANSPORT accepts a comma-separated list of
+// these, e.g. "stdio,http".
+const (
+	TransportStdio = "stdio"
+	TransportSSE   = "sse"
+	TransportHTTP  = "http"
+	TransportBoth  = "both" // stdio and SSE, kept for compatibility
+)
+
+const (
+	defaultSSEPort       = "8080"
+	defaultHTTPPort      = "8081"
+	defaultHTTPEndpoint  = "/mcp"
+	defaultHTTPHeartbeat = 30 * time.Second
+	shutdownTimeout      = 10 * time.Second
+)
+
+// shutdowner is implemented by the HTTP based transports
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
 func main() {
+	transports, err := parseTransports(os.Getenv(EnvTransport))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load the Tempo datasources before the tools describe them
+	if err := common.LoadConfig(); err != nil {
+		log.Fatalf("Failed to load Tempo datasources: %v", err)
+	}
+
+	// Hooks of all options are collected here, since server.WithHooks replaces
+	// the server's hooks
+	hooks := &server.Hooks{}
+
 	// Create a new MCP server
 	s := server.NewMCPServer(
 		"Tempo MCP Server",
 		version,
 		server.WithResourceCapabilities(true, true),
 		server.WithLogging(),
+		server.WithRecovery(),
+		server.WithHooks(hooks),
+		handlers.WithCancellation(hooks),
 	)
 
 	// Add Tempo query tool
@@ -31,43 +90,203 @@ func main() {
 	tempoTraceTool := handlers.NewTempoTraceTool()
 	s.AddTool(tempoTraceTool, handlers.HandleTempoTrace)
 
-	// Get SSE port from environment variable or use default
-	// ssePort := os.Getenv("SSE_PORT")
-	// if ssePort == "" {
-	// 	ssePort = "8080"
-	// }
+	// Add Tempo critical path tool
+	tempoCriticalPathTool := handlers.NewTempoCriticalPathTool()
+	s.AddTool(tempoCriticalPathTool, handlers.HandleTempoCriticalPath)
+
+	// Add Tempo tag discovery tool
+	tempoTagsTool := handlers.NewTempoTagsTool()
+	s.AddTool(tempoTagsTool, handlers.HandleTempoTags)
 
-	// // Create SSE server for HTTP/SSE connections
-	// sseServer := server.NewSSEServer(s,
-	// 	server.WithSSEEndpoint("/sse"),
-	// 	server.WithMessageEndpoint("/mcp"),
-	// )
+	// Add Tempo tag value lookup tool
+	tempoTagValuesTool := handlers.NewTempoTagValuesTool()
+	s.AddTool(tempoTagValuesTool, handlers.HandleTempoTagValues)
+
+	// Add TraceQL metrics tool
+	tempoMetricsTool := handlers.NewTempoMetricsTool()
+	s.AddTool(tempoMetricsTool, handlers.HandleTempoMetrics)
 
 	// Create a channel to handle shutdown signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	// Start HTTP server in a goroutine
-	// go func() {
-	// 	addr := fmt.Sprintf(":%s", ssePort)
-	// 	log.Printf("Starting SSE server on http://localhost%s", addr)
-	// 	log.Printf("SSE Endpoint: http://localhost%s/sse", addr)
-	// 	log.Printf("MCP Endpoint: http://localhost%s/mcp", addr)
+	// Cancelled on shutdown so that the stdio listener stops reading
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// 	if err := http.ListenAndServe(addr, sseServer); err != nil && err != http.ErrServerClosed {
-	// 		log.Fatalf("HTTP server error: %v", err)
-	// 	}
-	// }()
+	var httpServers []shutdowner
+	if transports[TransportSSE] {
+		httpServers = append(httpServers, startSSEServer(s, stop))
+	}
+	if transports[TransportHTTP] {
+		httpServers = append(httpServers, startStreamableHTTPServer(s, stop))
+	}
 
-	// For backward compatibility, also serve via stdio
-	go func() {
-		log.Println("Starting stdio server")
-		if err := server.ServeStdio(s); err != nil {
-			log.Printf("Stdio server error: %v", err)
-		}
-	}()
+	// Serve via stdio for clients that spawn the server as a subprocess
+	if transports[TransportStdio] {
+		go func() {
+			log.Println("Starting stdio server")
+			stdioServer := server.NewStdioServer(s)
+			stdioServer.SetErrorLogger(log.New(os.Stderr, "", log.LstdFlags))
+			if size := envInt(EnvStdioWorkerPool); size > 0 {
+				server.WithWorkerPoolSize(size)(stdioServer)
+			}
+			err := stdioServer.Listen(ctx, os.Stdin, os.Stdout)
+			if err != nil && err != context.Canceled {
+				log.Printf("Stdio server error: %v", err)
+			}
+
+			// When stdio is the only transport there is nothing left to serve
+			if len(httpServers) == 0 {
+				stop <- syscall.SIGTERM
+			}
+		}()
+	}
 
 	// Wait for interrupt signal
 	<-stop
 	log.Println("Shutting down servers...")
+	cancel()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	for _, srv := range httpServers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("HTTP server shutdown error: %v", err)
+		}
+	}
+}
+
+// parseTransports parses the comma-separated MCP_TRANSPORT value into a set
+// of enabled transports, defaulting to stdio only.
+func parseTransports(value string) (map[string]bool, error) {
+	transports := map[string]bool{}
+	if strings.TrimSpace(value) == "" {
+		transports[TransportStdio] = true
+		return transports, nil
+	}
+
+	for _, t := range strings.Split(strings.ToLower(value), ",") {
+		switch t = strings.TrimSpace(t); t {
+		case TransportStdio, TransportSSE, TransportHTTP:
+			transports[t] = true
+		case TransportBoth:
+			transports[TransportStdio] = true
+			transports[TransportSSE] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported %s value %q (expected a comma-separated list of %s, %s, %s)",
+				EnvTransport, t, TransportStdio, TransportSSE, TransportHTTP)
+		}
+	}
+	return transports, nil
+}
+
+// startSSEServer starts the legacy HTTP/SSE transport in the background. Fatal
+// listener errors are reported by signalling the stop channel.
+func startSSEServer(s *server.MCPServer, stop chan<- os.Signal) *server.SSEServer {
+	// Get SSE port from environment variable or use default
+	addr := fmt.Sprintf(":%s", envOrDefault(EnvSSEPort, defaultSSEPort))
+
+	opts := []server.SSEOption{
+		server.WithSSEEndpoint("/sse"),
+		server.WithMessageEndpoint("/mcp"),
+	}
+	if baseURL := os.Getenv(EnvSSEBaseURL); baseURL != "" {
+		opts = append(opts, server.WithBaseURL(baseURL))
+	}
+
+	// Create SSE server for HTTP/SSE connections
+	sseServer := server.NewSSEServer(s, opts...)
+
+	go func() {
+		log.Printf("Starting SSE server on http://localhost%s", addr)
+		log.Printf("SSE Endpoint: http://localhost%s/sse", addr)
+		log.Printf("MCP Endpoint: http://localhost%s/mcp", addr)
+
+		if err := sseServer.Start(addr); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP server error: %v", err)
+			stop <- syscall.SIGTERM
+		}
+	}()
+
+	return sseServer
+}
+
+// startStreamableHTTPServer starts the streamable HTTP transport in the
+// background. Sessions are stateful unless HTTP_STATELESS is set, and a
+// heartbeat is sent on open GET streams so that idle connections are not
+// reaped by load balancers. The events of a session's streams are kept for
+// HTTP_EVENT_RETENTION, so that clients can resume broken streams.
+func startStreamableHTTPServer(s *server.MCPServer, stop chan<- os.Signal) *server.StreamableHTTPServer {
+	addr := fmt.Sprintf(":%s", envOrDefault(EnvHTTPPort, defaultHTTPPort))
+
+	heartbeat := envDuration(EnvHTTPHeartbeat, defaultHTTPHeartbeat)
+	retention := envDuration(EnvHTTPRetention, eventstore.DefaultRetention)
+	stateless := strings.EqualFold(os.Getenv(EnvHTTPStateless), "true")
+
+	mux := http.NewServeMux()
+	httpServer := server.NewStreamableHTTPServer(s,
+		server.WithEndpointPath(defaultHTTPEndpoint),
+		server.WithStateful(!stateless),
+		server.WithStateLess(stateless),
+		server.WithHeartbeatInterval(heartbeat),
+		server.WithStreamableHTTPServer(&http.Server{Addr: addr, Handler: mux}),
+	)
+
+	var handler http.Handler = httpServer
+	if retention > 0 && !stateless {
+		handler = eventstore.NewStore(retention).Handler(httpServer)
+	}
+	mux.Handle(defaultHTTPEndpoint, handler)
+
+	go func() {
+		log.Printf("Starting streamable HTTP server on http://localhost%s", addr)
+		log.Printf("Streamable HTTP Endpoint: http://localhost%s%s (stateless: %t)", addr, defaultHTTPEndpoint, stateless)
+
+		if err := httpServer.Start(addr); err != nil && err != http.ErrServerClosed {
+			log.Printf("Streamable HTTP server error: %v", err)
+			stop <- syscall.SIGTERM
+		}
+	}()
+
+	return httpServer
+}
+
+// envOrDefault returns the value of the environment variable or the fallback
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envDuration returns the duration value of the environment variable, or the
+// fallback if it is unset or invalid
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s: %v", name, value, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+// envInt returns the integer value of the environment variable, or 0 if it is
+// unset or invalid
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s %q: %v", name, value, err)
+		return 0
+	}
+	return n
 }
@@ -0,0 +1,166 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default circuit breaker settings of a datasource
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenDuration     = 30 * time.Second
+)
+
+// CircuitBreakerConfig controls when requests to an unhealthy datasource are
+// rejected without contacting Tempo
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests that
+	// opens the circuit (default: 5)
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	// OpenDuration is how long the circuit stays open before a single probe
+	// request is let through (default: 30s)
+	OpenDuration time.Duration `yaml:"open_duration,omitempty"`
+	// Disabled always sends requests to Tempo
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// CircuitOpenError is returned instead of contacting a datasource whose
+// circuit breaker is open
+type CircuitOpenError struct {
+	Datasource string
+	Failures   int
+	RetryAt    time.Time
+	LastError  error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Tempo datasource %s is unavailable: %d consecutive requests failed (last error: %v); "+
+		"not sending requests until %s", e.Datasource, e.Failures, e.LastError, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastError
+}
+
+// validate checks that the circuit breaker settings are not negative
+func (c CircuitBreakerConfig) validate() error {
+	if c.FailureThreshold < 0 || c.OpenDuration < 0 {
+		return errors.New("failure_threshold and open_duration must not be negative")
+	}
+	return nil
+}
+
+// circuitBreaker tracks the consecutive failures of a datasource. Once the
+// threshold is reached requests fail fast until the open duration elapsed,
+// then one probe request decides whether the circuit closes again.
+type circuitBreaker struct {
+	name             string
+	failureThreshold int
+	openDuration     time.Duration
+	disabled         bool
+
+	mu        sync.Mutex
+	failures  int
+	lastError error
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(name string, config CircuitBreakerConfig) *circuitBreaker {
+	b := &circuitBreaker{
+		name:             name,
+		failureThreshold: config.FailureThreshold,
+		openDuration:     config.OpenDuration,
+		disabled:         config.Disabled,
+	}
+	if b.failureThreshold == 0 {
+		b.failureThreshold = DefaultFailureThreshold
+	}
+	if b.openDuration == 0 {
+		b.openDuration = DefaultOpenDuration
+	}
+	return b
+}
+
+// allow returns a CircuitOpenError when the request must not be sent
+func (b *circuitBreaker) allow() error {
+	if b.disabled {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.failureThreshold {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return &CircuitOpenError{
+			Datasource: b.name,
+			Failures:   b.failures,
+			RetryAt:    b.openUntil,
+			LastError:  b.lastError,
+		}
+	}
+	// Half-open: let a single request find out whether Tempo recovered
+	b.probing = true
+	return nil
+}
+
+// record updates the breaker with the outcome of a request that was allowed.
+// Requests cancelled by the caller, timeouts, errors caused by the connection
+// settings and requests that failed before reaching Tempo say nothing about
+// the datasource's health.
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	if b.disabled {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err != nil && (ctx.Err() != nil || !reachedTempo(err)) {
+		return
+	}
+	if !isUnhealthy(err) {
+		b.failures = 0
+		b.lastError = nil
+		return
+	}
+	b.failures++
+	b.lastError = err
+	if b.failures >= b.failureThreshold {
+		b.openUntil = time.Now().Add(b.openDuration)
+	}
+}
+
+// isUnhealthy reports whether an error indicates that the datasource is down
+// or overloaded: server errors, rate limiting, transient token endpoint
+// failures, connection failures and failed streaming searches. A rejected query says Tempo is healthy,
+// other errors such as an invalid URL say nothing about it and are ignored by
+// the breaker, see reachedTempo.
+func isUnhealthy(err error) bool {
+	if err == nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return !tokenErr.isPermanent()
+	}
+	return isConnectionFailure(err) || isStreamFailure(err)
+}
+
+// reachedTempo reports whether a failed request tells anything about the
+// datasource's health: Tempo responded, or could not be reached
+func reachedTempo(err error) bool {
+	var httpErr *HTTPError
+	var tokenErr *TokenError
+	return errors.As(err, &httpErr) || errors.As(err, &tokenErr) || isConnectionFailure(err) || isStreamFailure(err)
+}
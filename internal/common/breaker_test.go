@@ -0,0 +1,130 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	ctx := context.Background()
+	unavailable := &HTTPError{StatusCode: http.StatusServiceUnavailable}
+	b := newCircuitBreaker("test", CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: 20 * time.Millisecond})
+
+	// Closed: failures below the threshold let requests through
+	if err := b.allow(); err != nil {
+		t.Fatalf("closed breaker rejected a request: %v", err)
+	}
+	b.record(ctx, unavailable)
+	if err := b.allow(); err != nil {
+		t.Fatalf("breaker opened below the threshold: %v", err)
+	}
+	b.record(ctx, unavailable)
+
+	// Open: requests fail fast with the last error
+	err := b.allow()
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("open breaker returned %v, want CircuitOpenError", err)
+	}
+	if openErr.Failures != 2 || !errors.Is(err, unavailable) {
+		t.Errorf("CircuitOpenError = %+v, want 2 failures and the last error", openErr)
+	}
+
+	// Half-open: a single probe is let through once the open duration elapsed
+	time.Sleep(30 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("breaker did not let a probe through: %v", err)
+	}
+	if err := b.allow(); err == nil {
+		t.Fatal("breaker let a second request through while probing")
+	}
+
+	// A failed probe opens the circuit again
+	b.record(ctx, unavailable)
+	if err := b.allow(); err == nil {
+		t.Fatal("breaker closed after a failed probe")
+	}
+
+	// A successful probe closes it
+	time.Sleep(30 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("breaker did not let a probe through: %v", err)
+	}
+	b.record(ctx, nil)
+	if err := b.allow(); err != nil {
+		t.Fatalf("breaker stayed open after a successful probe: %v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresHealthyFailures(t *testing.T) {
+	unavailable := &HTTPError{StatusCode: http.StatusServiceUnavailable}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	malformedURL, missingSecret := requestSetupErrors(t)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"rejected query", context.Background(), &HTTPError{StatusCode: http.StatusBadRequest}},
+		{"cancelled by the caller", cancelled, context.Canceled},
+		{"client timeout", context.Background(), &url.Error{Op: "Get", URL: "http://tempo:3200", Err: timeoutError{}}},
+		{"malformed URL", context.Background(), malformedURL},
+		{"missing secret file", context.Background(), missingSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker("test", CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute})
+			b.record(context.Background(), unavailable)
+			b.record(tt.ctx, tt.err)
+			b.record(tt.ctx, tt.err)
+			if err := b.allow(); err != nil {
+				t.Fatalf("breaker opened: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsUnhealthy(t *testing.T) {
+	malformedURL, missingSecret := requestSetupErrors(t)
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"success", nil, false},
+		{"server error", &HTTPError{StatusCode: http.StatusInternalServerError}, true},
+		{"too many requests", &HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"rejected query", &HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{"connection refused", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, true},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"truncated response", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: io.ErrUnexpectedEOF}, true},
+		{"malformed URL", malformedURL, false},
+		{"missing secret file", missingSecret, false},
+		{"unclassified error", errors.New("something went wrong"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUnhealthy(tt.err); got != tt.want {
+				t.Errorf("isUnhealthy(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker("test", CircuitBreakerConfig{FailureThreshold: 1, Disabled: true})
+	b.record(context.Background(), &HTTPError{StatusCode: http.StatusServiceUnavailable})
+	if err := b.allow(); err != nil {
+		t.Fatalf("disabled breaker rejected a request: %v", err)
+	}
+}
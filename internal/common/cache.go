@@ -0,0 +1,212 @@
+package common
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables overriding the cache settings
+const (
+	EnvCacheMaxSizeMB = "TEMPO_CACHE_MAX_SIZE_MB"
+	EnvCacheTraceTTL  = "TEMPO_CACHE_TRACE_TTL"
+	EnvCacheTagTTL    = "TEMPO_CACHE_TAG_TTL"
+	EnvCacheDisabled  = "TEMPO_CACHE_DISABLED"
+)
+
+// Default cache settings
+const (
+	DefaultCacheMaxSizeMB = 64
+	DefaultCacheTraceTTL  = 10 * time.Minute
+	DefaultCacheTagTTL    = time.Minute
+)
+
+// CacheClass selects how long a cached response stays valid
+type CacheClass int
+
+const (
+	// CacheTrace is used for trace lookups. Traces rarely change once they
+	// are complete, so they are kept for a long time.
+	CacheTrace CacheClass = iota
+	// CacheTags is used for tag and tag value lookups, which change as new
+	// spans are ingested
+	CacheTags
+)
+
+// CacheConfig holds the settings of the in-memory response cache shared by
+// all datasources
+type CacheConfig struct {
+	// MaxSizeMB bounds the total size of the cached responses (default: 64)
+	MaxSizeMB int `yaml:"max_size_mb,omitempty"`
+	// TraceTTL and TagTTL are the lifetimes of cached traces and tag lookups
+	// (defaults: 10m and 1m)
+	TraceTTL time.Duration `yaml:"trace_ttl,omitempty"`
+	TagTTL   time.Duration `yaml:"tag_ttl,omitempty"`
+	Disabled bool          `yaml:"disabled,omitempty"`
+}
+
+// withEnv applies the cache settings given in the environment, which take
+// precedence over the configuration file
+func (c CacheConfig) withEnv() CacheConfig {
+	if value, err := strconv.Atoi(os.Getenv(EnvCacheMaxSizeMB)); err == nil {
+		c.MaxSizeMB = value
+	}
+	if value, err := time.ParseDuration(os.Getenv(EnvCacheTraceTTL)); err == nil {
+		c.TraceTTL = value
+	}
+	if value, err := time.ParseDuration(os.Getenv(EnvCacheTagTTL)); err == nil {
+		c.TagTTL = value
+	}
+	if value := os.Getenv(EnvCacheDisabled); value != "" {
+		c.Disabled = strings.EqualFold(value, "true") || value == "1"
+	}
+	return c
+}
+
+// validate checks that the cache settings are not negative
+func (c CacheConfig) validate() error {
+	if c.MaxSizeMB < 0 || c.TraceTTL < 0 || c.TagTTL < 0 {
+		return errors.New("max_size_mb, trace_ttl and tag_ttl must not be negative")
+	}
+	return nil
+}
+
+// ttl returns the lifetime of responses of the given class
+func (c CacheConfig) ttl(class CacheClass) time.Duration {
+	switch class {
+	case CacheTrace:
+		if c.TraceTTL > 0 {
+			return c.TraceTTL
+		}
+		return DefaultCacheTraceTTL
+	default:
+		if c.TagTTL > 0 {
+			return c.TagTTL
+		}
+		return DefaultCacheTagTTL
+	}
+}
+
+// maxBytes returns the size bound of the cache
+func (c CacheConfig) maxBytes() int {
+	if c.MaxSizeMB > 0 {
+		return c.MaxSizeMB << 20
+	}
+	return DefaultCacheMaxSizeMB << 20
+}
+
+// responseCache is a least-recently-used cache of response bodies bounded by
+// their total size. Every entry expires after the TTL of its class.
+type responseCache struct {
+	config CacheConfig
+
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	key     string
+	body    []byte
+	expires time.Time
+}
+
+var (
+	cacheMu     sync.Mutex
+	sharedCache *responseCache
+)
+
+// getCache returns the shared response cache, or nil when caching is disabled
+func getCache() *responseCache {
+	// Read the configuration before locking the cache, SetConfig resets the
+	// cache while holding the configuration lock
+	cfg := currentConfig().Cache.withEnv()
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cfg.Disabled {
+		return nil
+	}
+	if sharedCache == nil {
+		sharedCache = newResponseCache(cfg)
+	}
+	return sharedCache
+}
+
+// resetCache drops all cached responses, e.g. after the configuration changed
+func resetCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	sharedCache = nil
+}
+
+func newResponseCache(config CacheConfig) *responseCache {
+	return &responseCache{
+		config:  config,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// get returns the cached body for the key if it has not expired
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.body, true
+}
+
+// put stores the body, evicting the least recently used entries to stay
+// within the size bound. Bodies larger than the whole cache are not stored.
+func (c *responseCache) put(key string, body []byte, class CacheClass) {
+	size := len(key) + len(body)
+	if size > c.config.maxBytes() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	entry := &cacheEntry{key: key, body: body, expires: time.Now().Add(c.config.ttl(class))}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+
+	for c.size > c.config.maxBytes() {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove deletes an entry, the cache lock must be held
+func (c *responseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.key) + len(entry.body)
+}
+
+// cacheKey identifies a response by datasource, tenant, credentials and
+// query URL, so that tenants and users never see each other's data. The
+// credentials are hashed so that the keys do not contain secrets.
+func cacheKey(ds Datasource, tenant, queryURL string) string {
+	identity := sha256.Sum256([]byte(strings.Join([]string{ds.Auth.Username, ds.Auth.Password, ds.Auth.Token, ds.Auth.OAuth2.identity()}, "\x00")))
+	return strings.Join([]string{ds.Name, tenant, hex.EncodeToString(identity[:8]), queryURL}, "\x00")
+}
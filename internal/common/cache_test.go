@@ -0,0 +1,148 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResponseCache(CacheConfig{MaxSizeMB: 1})
+	body := bytes.Repeat([]byte("x"), 400<<10)
+
+	cache.put("a", body, CacheTrace)
+	cache.put("b", body, CacheTrace)
+	// Reading a makes b the least recently used entry
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("a is not cached")
+	}
+	cache.put("c", body, CacheTrace)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+	if cache.size > cache.config.maxBytes() {
+		t.Errorf("cache size %d exceeds the bound of %d", cache.size, cache.config.maxBytes())
+	}
+	if want := 2 * (1 + len(body)); cache.size != want {
+		t.Errorf("cache size = %d, want %d", cache.size, want)
+	}
+
+	// A body larger than the whole cache is not stored and evicts nothing
+	cache.put("huge", bytes.Repeat([]byte("x"), 2<<20), CacheTrace)
+	if _, ok := cache.get("huge"); ok {
+		t.Error("body larger than the cache was stored")
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("cache has %d entries, want 2", len(cache.entries))
+	}
+}
+
+func TestResponseCacheReplacesEntry(t *testing.T) {
+	cache := newResponseCache(CacheConfig{})
+	cache.put("key", []byte("old"), CacheTrace)
+	cache.put("key", []byte("newer"), CacheTrace)
+
+	if body, ok := cache.get("key"); !ok || string(body) != "newer" {
+		t.Errorf("get = %q, %v, want the newer body", body, ok)
+	}
+	if want := len("key") + len("newer"); cache.size != want {
+		t.Errorf("cache size = %d, want %d", cache.size, want)
+	}
+}
+
+func TestResponseCacheTTLPerClass(t *testing.T) {
+	cache := newResponseCache(CacheConfig{TraceTTL: time.Hour, TagTTL: 10 * time.Millisecond})
+	cache.put("trace", []byte("trace"), CacheTrace)
+	cache.put("tags", []byte("tags"), CacheTags)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.get("tags"); ok {
+		t.Error("tag lookup did not expire after the tag TTL")
+	}
+	if _, ok := cache.get("trace"); !ok {
+		t.Error("trace expired before the trace TTL")
+	}
+	if len(cache.entries) != 1 || cache.size != len("trace")*2 {
+		t.Errorf("expired entry was not removed: %d entries of %d bytes", len(cache.entries), cache.size)
+	}
+}
+
+func TestCacheConfigTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CacheConfig
+		class  CacheClass
+		want   time.Duration
+	}{
+		{"trace default", CacheConfig{}, CacheTrace, DefaultCacheTraceTTL},
+		{"tags default", CacheConfig{}, CacheTags, DefaultCacheTagTTL},
+		{"trace configured", CacheConfig{TraceTTL: time.Hour, TagTTL: time.Second}, CacheTrace, time.Hour},
+		{"tags configured", CacheConfig{TraceTTL: time.Hour, TagTTL: time.Second}, CacheTags, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.ttl(tt.class); got != tt.want {
+				t.Errorf("ttl = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheKeyIsolation(t *testing.T) {
+	base := Datasource{
+		Name: "tempo",
+		URL:  "http://tempo:3200",
+		Auth: AuthConfig{Username: "user", Password: "secret"},
+	}
+	const queryURL = "http://tempo:3200/api/traces/abc"
+	key := cacheKey(base, "team-a", queryURL)
+
+	if got := cacheKey(base, "team-a", queryURL); got != key {
+		t.Error("cache key of the same request differs")
+	}
+	if strings.Contains(key, "secret") {
+		t.Errorf("cache key %q contains the password", key)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(ds *Datasource, tenant, queryURL *string)
+	}{
+		{"tenant", func(ds *Datasource, tenant, queryURL *string) { *tenant = "team-b" }},
+		{"no tenant", func(ds *Datasource, tenant, queryURL *string) { *tenant = "" }},
+		{"query URL", func(ds *Datasource, tenant, queryURL *string) { *queryURL = "http://tempo:3200/api/traces/def" }},
+		{"datasource", func(ds *Datasource, tenant, queryURL *string) { ds.Name = "other" }},
+		{"username", func(ds *Datasource, tenant, queryURL *string) { ds.Auth.Username = "admin" }},
+		{"password", func(ds *Datasource, tenant, queryURL *string) { ds.Auth.Password = "other secret" }},
+		{"token", func(ds *Datasource, tenant, queryURL *string) { ds.Auth = AuthConfig{Token: "token"} }},
+		{"oauth2 client", func(ds *Datasource, tenant, queryURL *string) {
+			ds.Auth = AuthConfig{OAuth2: &OAuth2Config{TokenURL: "http://idp/token", ClientID: "client", ClientSecret: "secret"}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ds, tenant, queryURL := base, "team-a", queryURL
+			tt.modify(&ds, &tenant, &queryURL)
+			if cacheKey(ds, tenant, queryURL) == key {
+				t.Errorf("requests differing by %s share a cache key", tt.name)
+			}
+		})
+	}
+
+	// OAuth2 clients differing only by their secret are different identities
+	withSecret := func(secret string) Datasource {
+		ds := base
+		ds.Auth = AuthConfig{OAuth2: &OAuth2Config{TokenURL: "http://idp/token", ClientID: "client", ClientSecret: secret}}
+		return ds
+	}
+	if cacheKey(withSecret("one"), "", queryURL) == cacheKey(withSecret("two"), "", queryURL) {
+		t.Error("OAuth2 clients with different secrets share a cache key")
+	}
+}
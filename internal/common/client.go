@@ -0,0 +1,363 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Connection pool and dial settings of the shared transports
+const (
+	dialTimeout         = 10 * time.Second
+	keepAlive           = 30 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	maxIdleConns        = 100
+	maxIdleConnsPerHost = 10
+)
+
+// TempoClient sends requests to a single Tempo datasource. The underlying
+// http.Client, and with it the connection pool, is shared by all requests to
+// the same datasource so that connections are kept alive between tool calls.
+type TempoClient struct {
+	datasource Datasource
+	httpClient *http.Client
+	breaker    *circuitBreaker
+	// streamBreaker guards streaming searches separately, so that a Tempo
+	// without the streaming API does not block the HTTP tools
+	streamBreaker *circuitBreaker
+}
+
+// pooledClient is the shared http.Client of a configured datasource together
+// with the settings it was built from
+type pooledClient struct {
+	client   *http.Client
+	settings string
+}
+
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = map[string]*pooledClient{}
+	breakers      = map[string]*circuitBreaker{}
+	// streamBreakers are the circuit breakers of streaming searches
+	streamBreakers = map[string]*circuitBreaker{}
+)
+
+// ClientForRequest returns a client for the datasource selected by the tool
+// request, with any connection settings passed as arguments applied
+func ClientForRequest(toolRequest mcp.CallToolRequest) (*TempoClient, error) {
+	ds, err := ResolveDatasource(toolRequest)
+	if err != nil {
+		return nil, err
+	}
+	return NewTempoClient(ds)
+}
+
+// NewTempoClient returns a client for the datasource, reusing the pooled
+// http.Client of the datasource if one exists. The pooled client is rebuilt
+// when the TLS files it was built from change, so that rotated certificates
+// are picked up. Clients for URLs passed as arguments are not pooled and do
+// not share a circuit breaker, so that arbitrary hosts cannot accumulate
+// connections.
+func NewTempoClient(ds Datasource) (*TempoClient, error) {
+	if ds.adHoc {
+		transport, err := newTransport(ds)
+		if err != nil {
+			return nil, err
+		}
+		transport.DisableKeepAlives = true
+		return &TempoClient{
+			datasource:    ds,
+			httpClient:    &http.Client{Timeout: ds.timeout(), Transport: transport},
+			breaker:       newCircuitBreaker(ds.Name, ds.CircuitBreaker),
+			streamBreaker: newCircuitBreaker(ds.streamBreakerName(), ds.CircuitBreaker),
+		}, nil
+	}
+
+	settings := ds.connectionSettings()
+
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	pooled, ok := httpClients[ds.Name]
+	if !ok || pooled.settings != settings {
+		transport, err := newTransport(ds)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pooled.client.CloseIdleConnections()
+		}
+		pooled = &pooledClient{
+			client:   &http.Client{Timeout: ds.timeout(), Transport: transport},
+			settings: settings,
+		}
+		httpClients[ds.Name] = pooled
+	}
+
+	breaker, ok := breakers[ds.Name]
+	if !ok {
+		breaker = newCircuitBreaker(ds.Name, ds.CircuitBreaker)
+		breakers[ds.Name] = breaker
+	}
+	streamBreaker, ok := streamBreakers[ds.Name]
+	if !ok {
+		streamBreaker = newCircuitBreaker(ds.streamBreakerName(), ds.CircuitBreaker)
+		streamBreakers[ds.Name] = streamBreaker
+	}
+
+	return &TempoClient{datasource: ds, httpClient: pooled.client, breaker: breaker, streamBreaker: streamBreaker}, nil
+}
+
+// resetClients drops the pooled clients and breakers, e.g. after the configuration changed
+func resetClients() {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+	for name, pooled := range httpClients {
+		pooled.client.CloseIdleConnections()
+		delete(httpClients, name)
+	}
+	clear(breakers)
+	clear(streamBreakers)
+	resetGRPCConns()
+}
+
+// connectionSettings describes the settings a datasource's transport is built
+// from, including the modification times of its TLS files and the proxy
+// credentials
+func (d Datasource) connectionSettings() string {
+	return fmt.Sprintf("%s %s %+v %s %s", d.URL, d.timeout(), d.TLS, d.Proxy.identity(), d.TLS.filesVersion())
+}
+
+// newTransport builds the pooled transport of a datasource
+func newTransport(ds Datasource) (*http.Transport, error) {
+	tlsConfig, err := ds.TLS.clientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration for datasource %s: %v", ds.Name, err)
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: keepAlive}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		IdleConnTimeout:     idleConnTimeout,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		ForceAttemptHTTP2:   true,
+	}
+
+	proxy, err := ds.Proxy.proxyFunc()
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy configuration for datasource %s: %v", ds.Name, err)
+	}
+	transport.Proxy = proxy
+
+	return transport, nil
+}
+
+// Datasource returns the datasource the client sends requests to
+func (c *TempoClient) Datasource() Datasource {
+	return c.datasource
+}
+
+// Get sends a GET request to the URL built by makeQueryURL from the
+// datasource's base URL and returns the response body. For datasources
+// reached through Grafana the base URL is the Grafana datasource proxy.
+func (c *TempoClient) Get(ctx context.Context, logger *log.Logger, makeQueryURL func(string) (string, error)) ([]byte, error) {
+	ds := c.datasource
+	if ds.GrafanaDatasourceUID != "" {
+		logger.Printf("Using Tempo datasource %s through Grafana %s (datasource %s)", ds.Name, ds.URL, ds.GrafanaDatasourceUID)
+	} else {
+		logger.Printf("Using Tempo datasource %s: %s", ds.Name, ds.URL)
+	}
+	if ds.Proxy.URL != "" {
+		logger.Printf("Using proxy %s", ds.Proxy)
+	}
+	if ds.TLS.InsecureSkipVerify {
+		logger.Printf("WARNING: TLS certificate verification is disabled for datasource %s", ds.Name)
+	}
+
+	tenant, err := ParseTenant(ds.Tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	queryURL, err := makeQueryURL(ds.baseURL())
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant != "" {
+		logger.Printf("Using tenant: %s", tenant)
+	}
+
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	logger.Printf("Executing Tempo query: %s", queryURL)
+	body, err := c.getWithRetry(ctx, logger, queryURL, tenant)
+	c.breaker.record(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log to stderr instead of stdout
+	logger.Printf("Tempo raw response length: %d bytes", len(body))
+	return body, nil
+}
+
+// GetCached is like Get, but serves the response from the shared cache when
+// the same request succeeded recently. The class selects how long the
+// response is kept.
+func (c *TempoClient) GetCached(ctx context.Context, logger *log.Logger, class CacheClass, makeQueryURL func(string) (string, error)) ([]byte, error) {
+	return c.GetCachedIf(ctx, logger, class, nil, makeQueryURL)
+}
+
+// GetCachedIf is like GetCached, but only caches responses for which
+// cacheable returns true, e.g. to skip results that are about to change.
+// A nil cacheable caches every response.
+func (c *TempoClient) GetCachedIf(ctx context.Context, logger *log.Logger, class CacheClass, cacheable func([]byte) bool, makeQueryURL func(string) (string, error)) ([]byte, error) {
+	cache := getCache()
+	if cache == nil {
+		return c.Get(ctx, logger, makeQueryURL)
+	}
+
+	tenant, err := ParseTenant(c.datasource.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	queryURL, err := makeQueryURL(c.datasource.baseURL())
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(c.datasource, tenant, queryURL)
+	if body, ok := cache.get(key); ok {
+		logger.Printf("Serving cached response for %s (%d bytes)", queryURL, len(body))
+		return body, nil
+	}
+
+	body, err := c.Get(ctx, logger, makeQueryURL)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable != nil && !cacheable(body) {
+		logger.Printf("Not caching response for %s", queryURL)
+		return body, nil
+	}
+	cache.put(key, body, class)
+	return body, nil
+}
+
+// getWithRetry sends the request, retrying transient failures with jittered
+// exponential backoff. A Retry-After header sent with 429 and 503 responses
+// replaces the backoff unless it exceeds the configured maximum.
+func (c *TempoClient) getWithRetry(ctx context.Context, logger *log.Logger, queryURL, tenant string) ([]byte, error) {
+	retry := c.datasource.Retry
+	for attempt := 0; ; attempt++ {
+		body, err := c.get(ctx, queryURL, tenant)
+		if err == nil || attempt >= retry.maxRetries() || !isRetryable(ctx, err) {
+			return body, err
+		}
+
+		delay := retry.backoff(attempt + 1)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.RetryAfter > 0 {
+			if httpErr.RetryAfter > retry.maxBackoff() {
+				logger.Printf("Tempo asked to retry after %s, longer than the maximum backoff of %s", httpErr.RetryAfter, retry.maxBackoff())
+				return nil, err
+			}
+			delay = httpErr.RetryAfter
+		}
+
+		logger.Printf("Tempo request failed (%v), retry %d of %d in %s", err, attempt+1, retry.maxRetries(), delay.Round(time.Millisecond))
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// get sends a single GET request and returns the response body
+func (c *TempoClient) get(ctx context.Context, queryURL, tenant string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add authentication if provided
+	authorization, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	var reader io.Reader = resp.Body
+	if fn := readProgress(ctx); fn != nil && resp.StatusCode == http.StatusOK {
+		reader = &progressReader{r: resp.Body, total: resp.ContentLength, fn: fn}
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for HTTP errors
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return body, nil
+}
+
+// authorization returns the Authorization header value for the datasource's
+// credentials, or an empty string when it has none. Obtaining an OAuth2 token
+// gives up when ctx is done.
+func (c *TempoClient) authorization(ctx context.Context) (string, error) {
+	auth := c.datasource.Auth
+	switch {
+	case auth.Token != "":
+		// Bearer token authentication
+		return "Bearer " + auth.Token, nil
+	case auth.OAuth2 != nil:
+		// Bearer token obtained with the client credentials flow
+		source, err := auth.OAuth2.tokenSource(c.datasource)
+		if err != nil {
+			return "", err
+		}
+		token, err := fetchToken(ctx, source)
+		if err != nil {
+			return "", &TokenError{Err: err}
+		}
+		return token.Type() + " " + token.AccessToken, nil
+	case auth.Username != "" || auth.Password != "":
+		// Basic authentication
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		return "Basic " + credentials, nil
+	}
+	return "", nil
+}
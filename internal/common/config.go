@@ -0,0 +1,252 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable name for the datasource configuration file
+const EnvTempoConfig = "TEMPO_CONFIG"
+
+// Name of the datasource built from the environment when no configuration file is used
+const DefaultDatasourceName = "default"
+
+// Default timeout for requests to Tempo
+const DefaultTimeout = 30 * time.Second
+
+// Config is the datasource configuration file. Both YAML and JSON are accepted.
+type Config struct {
+	// Default is the name of the datasource used when a tool call does not
+	// select one. Defaults to the first datasource.
+	Default     string       `yaml:"default"`
+	Datasources []Datasource `yaml:"datasources"`
+	// HideAuthParams removes the username, password and token arguments
+	// from the tools so that credentials never pass through the model
+	HideAuthParams bool `yaml:"hide_auth_params,omitempty"`
+	// Cache configures the cache of trace and tag lookups
+	Cache CacheConfig `yaml:"cache,omitempty"`
+}
+
+// Datasource describes how to connect to a single Tempo instance
+type Datasource struct {
+	Name   string `yaml:"name"`
+	URL    string `yaml:"url"`
+	Tenant string `yaml:"tenant,omitempty"`
+	// GrafanaDatasourceUID routes requests through the datasource proxy of
+	// the Grafana instance at URL instead of calling Tempo directly. Auth then
+	// holds the Grafana credentials, typically a service account token.
+	GrafanaDatasourceUID string        `yaml:"grafana_datasource_uid,omitempty"`
+	Auth                 AuthConfig    `yaml:"auth,omitempty"`
+	TLS                  TLSConfig     `yaml:"tls,omitempty"`
+	Proxy                ProxyConfig   `yaml:"proxy,omitempty"`
+	Timeout              time.Duration `yaml:"timeout,omitempty"`
+	// Streaming runs tempo_query searches over Tempo's gRPC streaming API by
+	// default, bounded by StreamTimeout (default: 5m) instead of Timeout
+	Streaming     bool          `yaml:"streaming,omitempty"`
+	StreamTimeout time.Duration `yaml:"stream_timeout,omitempty"`
+	// Retry and CircuitBreaker protect against an overloaded or unavailable Tempo
+	Retry          RetryConfig          `yaml:"retry,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker,omitempty"`
+
+	// adHoc is set when a url argument replaced the configured URL
+	adHoc bool
+}
+
+// AuthConfig holds the credentials used for a datasource. Token takes
+// precedence over basic authentication. Secrets may be given inline, as
+// ${VAR} environment variable references or as paths to files containing them.
+type AuthConfig struct {
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+	Token        string `yaml:"token,omitempty"`
+	TokenFile    string `yaml:"token_file,omitempty"`
+	// OAuth2 obtains bearer tokens with the client credentials flow
+	OAuth2 *OAuth2Config `yaml:"oauth2,omitempty"`
+}
+
+// TLSConfig holds the TLS settings of a datasource
+type TLSConfig struct {
+	// CAFile is a PEM bundle of CAs trusted in addition to the system roots
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the client certificate and key for mutual TLS
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// ServerName overrides the host name used to verify the server certificate
+	ServerName         string `yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+var (
+	configMu sync.RWMutex
+	config   *Config
+)
+
+// LoadConfig loads the datasource configuration from the file named by
+// TEMPO_CONFIG, or builds a single default datasource from TEMPO_URL and
+// TEMPO_TENANT when it is not set. It must be called before the tools are
+// created.
+func LoadConfig() error {
+	path := os.Getenv(EnvTempoConfig)
+	if path == "" {
+		cfg := defaultConfig()
+		if err := cfg.validate(); err != nil {
+			return fmt.Errorf("invalid configuration in the environment: %v", err)
+		}
+		SetConfig(cfg)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid configuration in %s: %v", path, err)
+	}
+	for i := range cfg.Datasources {
+		cfg.Datasources[i].Auth = cfg.Datasources[i].Auth.expandEnv()
+		cfg.Datasources[i].Proxy = cfg.Datasources[i].Proxy.expandEnv()
+	}
+
+	SetConfig(&cfg)
+	return nil
+}
+
+// SetConfig replaces the active datasource configuration
+func SetConfig(cfg *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = cfg
+	resetClients()
+	resetCache()
+	resetTokenSources()
+}
+
+// currentConfig returns the active configuration, falling back to the
+// environment when LoadConfig was not called
+func currentConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if config == nil {
+		return defaultConfig()
+	}
+	return config
+}
+
+// defaultConfig builds the configuration from the environment
+func defaultConfig() *Config {
+	tempoURL := os.Getenv(EnvTempoURL)
+	if tempoURL == "" {
+		tempoURL = DefaultTempoURL
+	}
+	return &Config{
+		Default: DefaultDatasourceName,
+		Datasources: []Datasource{{
+			Name:                 DefaultDatasourceName,
+			URL:                  tempoURL,
+			Tenant:               os.Getenv(EnvTempoTenant),
+			GrafanaDatasourceUID: os.Getenv(EnvTempoGrafanaDatasourceUID),
+			Auth:                 authFromEnv(),
+			TLS:                  tlsFromEnv(),
+		}},
+	}
+}
+
+// validate checks the configuration for missing or duplicate settings
+func (c *Config) validate() error {
+	if len(c.Datasources) == 0 {
+		return fmt.Errorf("no datasources defined")
+	}
+
+	seen := map[string]bool{}
+	for i, ds := range c.Datasources {
+		if ds.Name == "" {
+			return fmt.Errorf("datasource %d has no name", i+1)
+		}
+		if seen[ds.Name] {
+			return fmt.Errorf("duplicate datasource name %q", ds.Name)
+		}
+		seen[ds.Name] = true
+		if ds.URL == "" {
+			return fmt.Errorf("datasource %q has no url", ds.Name)
+		}
+		if err := ds.TLS.validate(); err != nil {
+			return fmt.Errorf("datasource %q: invalid tls settings: %v", ds.Name, err)
+		}
+		if err := ds.Proxy.expandEnv().validate(); err != nil {
+			return fmt.Errorf("datasource %q: invalid proxy settings: %v", ds.Name, err)
+		}
+		if ds.Streaming && (ds.GrafanaDatasourceUID != "" || ds.Proxy.expandEnv().URL != "") {
+			return fmt.Errorf("datasource %q: streaming dials Tempo directly and cannot be combined with grafana_datasource_uid or proxy.url", ds.Name)
+		}
+		if ds.Auth.OAuth2 != nil {
+			if err := ds.Auth.OAuth2.validate(); err != nil {
+				return fmt.Errorf("datasource %q: invalid oauth2 settings: %v", ds.Name, err)
+			}
+			if ds.Auth.hasStaticCredentials() {
+				return fmt.Errorf("datasource %q: oauth2 cannot be combined with token, token_file, username, password or password_file", ds.Name)
+			}
+		}
+		if err := ds.Retry.validate(); err != nil {
+			return fmt.Errorf("datasource %q: invalid retry settings: %v", ds.Name, err)
+		}
+		if err := ds.CircuitBreaker.validate(); err != nil {
+			return fmt.Errorf("datasource %q: invalid circuit_breaker settings: %v", ds.Name, err)
+		}
+	}
+
+	if err := c.Cache.validate(); err != nil {
+		return fmt.Errorf("invalid cache settings: %v", err)
+	}
+
+	if c.Default != "" && !seen[c.Default] {
+		return fmt.Errorf("default datasource %q is not defined", c.Default)
+	}
+	return nil
+}
+
+// Datasource returns the datasource with the given name, or the default
+// datasource when name is empty
+func (c *Config) Datasource(name string) (Datasource, error) {
+	if name == "" {
+		name = c.Default
+		if name == "" {
+			return c.Datasources[0], nil
+		}
+	}
+	for _, ds := range c.Datasources {
+		if ds.Name == name {
+			return ds, nil
+		}
+	}
+	return Datasource{}, fmt.Errorf("unknown datasource %q (available: %v)", name, c.Names())
+}
+
+// Names returns the sorted names of the configured datasources
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Datasources))
+	for _, ds := range c.Datasources {
+		names = append(names, ds.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// timeout returns the request timeout of the datasource
+func (d Datasource) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return DefaultTimeout
+}
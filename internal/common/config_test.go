@@ -0,0 +1,59 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tempo := Datasource{Name: "tempo", URL: "http://tempo:3200"}
+	with := func(modify func(ds *Datasource)) Config {
+		ds := tempo
+		modify(&ds)
+		return Config{Datasources: []Datasource{ds}}
+	}
+	tests := []struct {
+		name string
+		cfg  Config
+		err  string
+	}{
+		{"valid", Config{Datasources: []Datasource{tempo, {Name: "other", URL: "http://other:3200"}}, Default: "other"}, ""},
+		{"no datasources", Config{}, "no datasources defined"},
+		{"no name", Config{Datasources: []Datasource{tempo, {URL: "http://other:3200"}}}, "datasource 2 has no name"},
+		{"duplicate name", Config{Datasources: []Datasource{tempo, tempo}}, `duplicate datasource name "tempo"`},
+		{"no url", with(func(ds *Datasource) { ds.URL = "" }), `datasource "tempo" has no url`},
+		{"unknown default", Config{Datasources: []Datasource{tempo}, Default: "other"}, `default datasource "other" is not defined`},
+		{"cert without key", with(func(ds *Datasource) { ds.TLS.CertFile = "client.pem" }), "invalid tls settings: cert_file and key_file must be set together"},
+		{"proxy url and disabled", with(func(ds *Datasource) { ds.Proxy = ProxyConfig{URL: "http://proxy:3128", Disabled: true} }), "invalid proxy settings: url and disabled are mutually exclusive"},
+		{"proxy scheme", with(func(ds *Datasource) { ds.Proxy.URL = "ftp://proxy:21" }), "invalid proxy settings: unsupported proxy scheme"},
+		{"oauth2 without client", with(func(ds *Datasource) { ds.Auth.OAuth2 = &OAuth2Config{TokenURL: "http://idp/token"} }), "invalid oauth2 settings: token_url and client_id are required"},
+		{"oauth2 with two secrets", with(func(ds *Datasource) {
+			ds.Auth.OAuth2 = &OAuth2Config{TokenURL: "http://idp/token", ClientID: "client", ClientSecret: "secret", ClientSecretFile: "secret.txt"}
+		}), "client_secret and client_secret_file are mutually exclusive"},
+		{"oauth2 with token", with(func(ds *Datasource) {
+			ds.Auth = AuthConfig{Token: "token", OAuth2: &OAuth2Config{TokenURL: "http://idp/token", ClientID: "client"}}
+		}), "oauth2 cannot be combined with token"},
+		{"negative retries", with(func(ds *Datasource) { ds.Retry.MaxRetries = -1 }), "invalid retry settings: max_retries, initial_backoff and max_backoff must not be negative"},
+		{"backoff bounds", with(func(ds *Datasource) { ds.Retry.InitialBackoff, ds.Retry.MaxBackoff = time.Minute, time.Second }), "initial_backoff must not exceed max_backoff"},
+		{"negative breaker threshold", with(func(ds *Datasource) { ds.CircuitBreaker.FailureThreshold = -1 }), "invalid circuit_breaker settings"},
+		{"negative cache size", Config{Datasources: []Datasource{tempo}, Cache: CacheConfig{MaxSizeMB: -1}}, "invalid cache settings"},
+		{"streaming", with(func(ds *Datasource) { ds.Streaming = true }), ""},
+		{"streaming through grafana", with(func(ds *Datasource) { ds.GrafanaDatasourceUID, ds.Streaming = "abc", true }), "cannot be combined with grafana_datasource_uid or proxy.url"},
+		{"streaming through a proxy", with(func(ds *Datasource) { ds.Proxy.URL, ds.Streaming = "http://proxy:8080", true }), "cannot be combined with grafana_datasource_uid or proxy.url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("validate = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
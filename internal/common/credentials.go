@@ -0,0 +1,92 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables holding the credentials of the default datasource
+const (
+	EnvTempoUsername     = "TEMPO_USERNAME"
+	EnvTempoPassword     = "TEMPO_PASSWORD"
+	EnvTempoPasswordFile = "TEMPO_PASSWORD_FILE"
+	EnvTempoToken        = "TEMPO_TOKEN"
+	EnvTempoTokenFile    = "TEMPO_TOKEN_FILE"
+)
+
+// Environment variable removing the username, password and token arguments
+// from the tool schemas, so that only server-side credentials are used
+const EnvHideAuthParams = "TEMPO_HIDE_AUTH_PARAMS"
+
+// authFromEnv builds the credentials of the default datasource from the environment
+func authFromEnv() AuthConfig {
+	return AuthConfig{
+		Username:     os.Getenv(EnvTempoUsername),
+		Password:     os.Getenv(EnvTempoPassword),
+		PasswordFile: os.Getenv(EnvTempoPasswordFile),
+		Token:        os.Getenv(EnvTempoToken),
+		TokenFile:    os.Getenv(EnvTempoTokenFile),
+		OAuth2:       oauth2FromEnv(),
+	}
+}
+
+// expandEnv replaces ${VAR} references in the credentials of the
+// configuration file with the values of the environment variables
+func (a AuthConfig) expandEnv() AuthConfig {
+	a.Username = os.ExpandEnv(a.Username)
+	a.Password = os.ExpandEnv(a.Password)
+	a.PasswordFile = os.ExpandEnv(a.PasswordFile)
+	a.Token = os.ExpandEnv(a.Token)
+	a.TokenFile = os.ExpandEnv(a.TokenFile)
+	a.OAuth2 = a.OAuth2.expandEnv()
+	return a
+}
+
+// hasStaticCredentials reports whether a token or basic authentication
+// credentials are configured
+func (a AuthConfig) hasStaticCredentials() bool {
+	return a.Token != "" || a.TokenFile != "" || a.Username != "" || a.Password != "" || a.PasswordFile != ""
+}
+
+// resolve reads credentials stored in files. Files are read on every request
+// so that rotated secrets, e.g. Kubernetes-mounted ones, are picked up.
+func (a AuthConfig) resolve() (AuthConfig, error) {
+	if a.PasswordFile != "" && a.Password == "" {
+		password, err := readSecretFile(a.PasswordFile)
+		if err != nil {
+			return AuthConfig{}, fmt.Errorf("failed to read password file: %v", err)
+		}
+		a.Password = password
+	}
+	if a.TokenFile != "" && a.Token == "" {
+		token, err := readSecretFile(a.TokenFile)
+		if err != nil {
+			return AuthConfig{}, fmt.Errorf("failed to read token file: %v", err)
+		}
+		a.Token = token
+	}
+	oauth2Config, err := a.OAuth2.resolve()
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	a.OAuth2 = oauth2Config
+	return a, nil
+}
+
+// readSecretFile reads a secret from a file, trimming surrounding whitespace
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// hideAuthParams reports whether credentials may only be configured server-side
+func (c *Config) hideAuthParams() bool {
+	if value := os.Getenv(EnvHideAuthParams); value != "" {
+		return strings.EqualFold(value, "true") || value == "1"
+	}
+	return c.HideAuthParams
+}
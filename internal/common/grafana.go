@@ -0,0 +1,23 @@
+package common
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Environment variable routing the default datasource through a Grafana
+// datasource proxy, in which case TEMPO_URL is the Grafana URL
+const EnvTempoGrafanaDatasourceUID = "TEMPO_GRAFANA_DATASOURCE_UID"
+
+// grafanaProxyPath is the prefix of Grafana's datasource proxy endpoint
+const grafanaProxyPath = "/api/datasources/proxy/uid/"
+
+// baseURL returns the URL the Tempo API paths are appended to. For
+// datasources reached through Grafana this is the datasource proxy endpoint
+// of the Tempo datasource, otherwise the Tempo URL itself.
+func (d Datasource) baseURL() string {
+	if d.GrafanaDatasourceUID == "" {
+		return d.URL
+	}
+	return strings.TrimSuffix(d.URL, "/") + grafanaProxyPath + url.PathEscape(d.GrafanaDatasourceUID)
+}
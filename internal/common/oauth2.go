@@ -0,0 +1,206 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Environment variables holding the OAuth2 client credentials of the default datasource
+const (
+	EnvTempoOAuth2TokenURL         = "TEMPO_OAUTH2_TOKEN_URL"
+	EnvTempoOAuth2ClientID         = "TEMPO_OAUTH2_CLIENT_ID"
+	EnvTempoOAuth2ClientSecret     = "TEMPO_OAUTH2_CLIENT_SECRET"
+	EnvTempoOAuth2ClientSecretFile = "TEMPO_OAUTH2_CLIENT_SECRET_FILE"
+	EnvTempoOAuth2Scopes           = "TEMPO_OAUTH2_SCOPES"
+)
+
+// OAuth2Config configures the client credentials flow used to obtain bearer
+// tokens for a datasource, e.g. when Tempo sits behind an OAuth2 proxy
+type OAuth2Config struct {
+	TokenURL         string   `yaml:"token_url"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret,omitempty"`
+	ClientSecretFile string   `yaml:"client_secret_file,omitempty"`
+	Scopes           []string `yaml:"scopes,omitempty"`
+	// EndpointParams are additional parameters sent to the token endpoint,
+	// e.g. audience or resource
+	EndpointParams map[string]string `yaml:"endpoint_params,omitempty"`
+}
+
+var (
+	tokenSourcesMu sync.Mutex
+	tokenSources   = map[string]oauth2.TokenSource{}
+)
+
+// oauth2FromEnv builds the OAuth2 settings of the default datasource from the
+// environment, or returns nil when no token URL is set
+func oauth2FromEnv() *OAuth2Config {
+	tokenURL := os.Getenv(EnvTempoOAuth2TokenURL)
+	if tokenURL == "" {
+		return nil
+	}
+	var scopes []string
+	for _, scope := range strings.Split(os.Getenv(EnvTempoOAuth2Scopes), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &OAuth2Config{
+		TokenURL:         tokenURL,
+		ClientID:         os.Getenv(EnvTempoOAuth2ClientID),
+		ClientSecret:     os.Getenv(EnvTempoOAuth2ClientSecret),
+		ClientSecretFile: os.Getenv(EnvTempoOAuth2ClientSecretFile),
+		Scopes:           scopes,
+	}
+}
+
+// validate checks that the token endpoint and client are configured
+func (c *OAuth2Config) validate() error {
+	if c.TokenURL == "" || c.ClientID == "" {
+		return errors.New("token_url and client_id are required")
+	}
+	if c.ClientSecret != "" && c.ClientSecretFile != "" {
+		return errors.New("client_secret and client_secret_file are mutually exclusive")
+	}
+	return nil
+}
+
+// expandEnv replaces ${VAR} references in the OAuth2 settings of the
+// configuration file with the values of the environment variables
+func (c *OAuth2Config) expandEnv() *OAuth2Config {
+	if c == nil {
+		return nil
+	}
+	expanded := *c
+	expanded.TokenURL = os.ExpandEnv(c.TokenURL)
+	expanded.ClientID = os.ExpandEnv(c.ClientID)
+	expanded.ClientSecret = os.ExpandEnv(c.ClientSecret)
+	expanded.ClientSecretFile = os.ExpandEnv(c.ClientSecretFile)
+	return &expanded
+}
+
+// resolve reads the client secret from its file. Like the other secret
+// files it is read on every request so that rotated secrets are picked up.
+func (c *OAuth2Config) resolve() (*OAuth2Config, error) {
+	if c == nil || c.ClientSecretFile == "" {
+		return c, nil
+	}
+	secret, err := readSecretFile(c.ClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client secret file: %v", err)
+	}
+	resolved := *c
+	resolved.ClientSecret = secret
+	return &resolved, nil
+}
+
+// identity returns a string identifying the client, used to keep tokens and
+// cached responses of different clients apart without storing the secret
+func (c *OAuth2Config) identity() string {
+	if c == nil {
+		return ""
+	}
+	secret := sha256.Sum256([]byte(c.ClientSecret))
+	return strings.Join([]string{c.TokenURL, c.ClientID, strings.Join(c.Scopes, " "), hex.EncodeToString(secret[:8])}, "\x00")
+}
+
+// tokenSource returns the token source of the datasource's OAuth2 client.
+// Token sources are shared, so a token is only requested again shortly
+// before it expires. The token endpoint is a different host than Tempo, so
+// tokens are fetched with a client of their own that uses the system CAs and
+// only shares the datasource's proxy settings.
+func (c *OAuth2Config) tokenSource(ds Datasource) (oauth2.TokenSource, error) {
+	key := c.identity() + "\x00" + ds.Proxy.identity()
+
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+	if source, ok := tokenSources[key]; ok {
+		return source, nil
+	}
+
+	transport, err := newTransport(Datasource{Name: ds.Name, Proxy: ds.Proxy})
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Timeout: DefaultTimeout, Transport: transport}
+
+	params := map[string][]string{}
+	for name, value := range c.EndpointParams {
+		params[name] = []string{value}
+	}
+	credentials := &clientcredentials.Config{
+		ClientID:       c.ClientID,
+		ClientSecret:   c.ClientSecret,
+		TokenURL:       c.TokenURL,
+		Scopes:         c.Scopes,
+		EndpointParams: params,
+	}
+	// The context is kept by the token source for later refreshes, so it must
+	// not be the context of a single tool call
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	source := credentials.TokenSource(ctx)
+	tokenSources[key] = source
+	return source, nil
+}
+
+// fetchToken returns a token of the source, giving up when ctx is done. The
+// shared source does not take a context, so the token is fetched in the
+// background, where a fetch the caller gave up on still completes within the
+// token client's timeout and is kept for later requests.
+func fetchToken(ctx context.Context, source oauth2.TokenSource) (*oauth2.Token, error) {
+	type result struct {
+		token *oauth2.Token
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		token, err := source.Token()
+		done <- result{token, err}
+	}()
+	select {
+	case r := <-done:
+		return r.token, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resetTokenSources drops the cached tokens, e.g. after the configuration changed
+func resetTokenSources() {
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+	clear(tokenSources)
+}
+
+// TokenError is returned when no bearer token could be obtained from the
+// OAuth2 token endpoint
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("failed to obtain OAuth2 token: %v", e.Err)
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// isPermanent reports whether the token endpoint rejected the client, in
+// which case retrying does not help
+func (e *TokenError) isPermanent() bool {
+	var retrieveErr *oauth2.RetrieveError
+	return errors.As(e.Err, &retrieveErr) && retrieveErr.Response != nil &&
+		retrieveErr.Response.StatusCode < http.StatusInternalServerError &&
+		retrieveErr.Response.StatusCode != http.StatusTooManyRequests
+}
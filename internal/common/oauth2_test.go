@@ -0,0 +1,139 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTokenServer returns an OAuth2 token endpoint issuing the token to the
+// client "tempo-mcp", counting the tokens requested
+func newTokenServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "tempo-mcp" || secret != "secret" {
+			http.Error(w, `{"error": "invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			http.Error(w, `{"error": "unsupported_grant_type"}`, http.StatusBadRequest)
+			return
+		}
+		handle(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// oauth2Datasource returns a datasource obtaining its tokens from the server
+func oauth2Datasource(name, tempoURL, tokenURL string) Datasource {
+	return Datasource{
+		Name:  name,
+		URL:   tempoURL,
+		Retry: RetryConfig{Disabled: true},
+		Auth: AuthConfig{OAuth2: &OAuth2Config{
+			TokenURL:     tokenURL,
+			ClientID:     "tempo-mcp",
+			ClientSecret: "secret",
+		}},
+	}
+}
+
+func TestOAuth2TokenFlow(t *testing.T) {
+	tokenServer, tokenRequests := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "issued-token", "token_type": "Bearer", "expires_in": 3600}`))
+	})
+	tempo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer issued-token" {
+			http.Error(w, "unexpected Authorization "+got, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"traces": []}`))
+	}))
+	defer tempo.Close()
+	resetClients()
+	resetTokenSources()
+	defer resetClients()
+	defer resetTokenSources()
+
+	client, err := NewTempoClient(oauth2Datasource("oauth2-flow", tempo.URL, tokenServer.URL))
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	for range 2 {
+		if _, err := client.Get(context.Background(), logger, func(base string) (string, error) { return base + "/api/search", nil }); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+	if n := tokenRequests.Load(); n != 1 {
+		t.Errorf("token endpoint was called %d times, want the token to be reused", n)
+	}
+}
+
+func TestOAuth2TokenRejected(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, nil)
+	resetTokenSources()
+	defer resetTokenSources()
+
+	ds := oauth2Datasource("oauth2-rejected", "http://tempo.invalid", tokenServer.URL)
+	ds.Auth.OAuth2.ClientSecret = "wrong"
+	client, err := NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	_, err = client.authorization(context.Background())
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) || !tokenErr.isPermanent() {
+		t.Fatalf("authorization returned %v, want a permanent TokenError", err)
+	}
+	if isRetryable(context.Background(), err) {
+		t.Error("rejected client credentials are retried")
+	}
+}
+
+func TestOAuth2TokenRespectsContext(t *testing.T) {
+	release := make(chan struct{})
+	tokenServer, _ := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	// Unblock the token endpoint before the server is closed
+	defer close(release)
+	var tempoRequests atomic.Int32
+	tempo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tempoRequests.Add(1)
+	}))
+	defer tempo.Close()
+	resetClients()
+	resetTokenSources()
+	defer resetClients()
+	defer resetTokenSources()
+
+	client, err := NewTempoClient(oauth2Datasource("oauth2-slow", tempo.URL, tokenServer.URL))
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err = client.Get(ctx, log.New(io.Discard, "", 0), func(base string) (string, error) { return base + "/api/search", nil })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get returned %v, want the context's deadline error", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Get returned after %s, want it to give up at the deadline", elapsed)
+	}
+	if n := tempoRequests.Load(); n != 0 {
+		t.Errorf("Tempo received %d requests without a token", n)
+	}
+}
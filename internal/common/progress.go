@@ -0,0 +1,47 @@
+package common
+
+import (
+	"context"
+	"io"
+)
+
+// ReadProgressFunc is called while a Tempo response is read with the number
+// of bytes received so far and the size announced by Tempo, or -1 until the
+// whole response has been read when Tempo did not announce it
+type ReadProgressFunc func(received, total int64)
+
+type readProgressKey struct{}
+
+// WithReadProgress returns a context that makes requests sent with it report
+// how much of the response body has been received to fn
+func WithReadProgress(ctx context.Context, fn ReadProgressFunc) context.Context {
+	return context.WithValue(ctx, readProgressKey{}, fn)
+}
+
+// readProgress returns the progress callback of the context, if any
+func readProgress(ctx context.Context) ReadProgressFunc {
+	fn, _ := ctx.Value(readProgressKey{}).(ReadProgressFunc)
+	return fn
+}
+
+// progressReader reports the bytes read from the wrapped reader
+type progressReader struct {
+	r        io.Reader
+	received int64
+	total    int64
+	fn       ReadProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.received += int64(n)
+		p.fn(p.received, p.total)
+	}
+	if err == io.EOF && p.total < 0 {
+		// The size is known once the whole response has been read
+		p.total = p.received
+		p.fn(p.received, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProxyConfig holds the proxy settings of a datasource. Without a URL the
+// standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+type ProxyConfig struct {
+	// URL of the proxy, e.g. http://proxy:3128, https://proxy:3129 or
+	// socks5://proxy:1080. Credentials may be included as user:password@.
+	URL string `yaml:"url,omitempty"`
+	// Username and Password authenticate against the proxy and take
+	// precedence over credentials in the URL
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// Disabled connects directly, ignoring the proxy environment variables
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// validProxySchemes lists the proxy URL schemes supported by net/http
+var validProxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// expandEnv replaces ${VAR} references in the proxy settings of the
+// configuration file with the values of the environment variables
+func (p ProxyConfig) expandEnv() ProxyConfig {
+	p.URL = os.ExpandEnv(p.URL)
+	p.Username = os.ExpandEnv(p.Username)
+	p.Password = os.ExpandEnv(p.Password)
+	return p
+}
+
+// validate checks that the proxy settings are consistent and the URL can be used
+func (p ProxyConfig) validate() error {
+	if p.Disabled && p.URL != "" {
+		return fmt.Errorf("url and disabled are mutually exclusive")
+	}
+	if p.URL == "" {
+		if p.Username != "" || p.Password != "" {
+			return fmt.Errorf("username and password require a url")
+		}
+		return nil
+	}
+	_, err := p.proxyURL()
+	return err
+}
+
+// proxyURL parses the proxy URL, defaulting to the http scheme as the
+// environment variables do, and applies the configured credentials
+func (p ProxyConfig) proxyURL() (*url.URL, error) {
+	raw := p.URL
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	if !slices.Contains(validProxySchemes, proxyURL.Scheme) {
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected one of %s)", proxyURL.Scheme, strings.Join(validProxySchemes, ", "))
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", p.URL)
+	}
+	if p.Username != "" || p.Password != "" {
+		proxyURL.User = url.UserPassword(p.Username, p.Password)
+	}
+	return proxyURL, nil
+}
+
+// proxyFunc returns the proxy selection function of the transport
+func (p ProxyConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if p.Disabled {
+		return nil, nil
+	}
+	if p.URL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := p.proxyURL()
+	if err != nil {
+		return nil, err
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// identity returns a string identifying the proxy settings, credentials
+// included, used to rebuild clients when any of them changes. Unlike String
+// it does not redact the password, which is hashed instead.
+func (p ProxyConfig) identity() string {
+	settings := sha256.Sum256([]byte(strings.Join([]string{strconv.FormatBool(p.Disabled), p.URL, p.Username, p.Password}, "\x00")))
+	return hex.EncodeToString(settings[:])
+}
+
+// String describes the proxy for logging without revealing credentials
+func (p ProxyConfig) String() string {
+	switch {
+	case p.Disabled:
+		return "disabled"
+	case p.URL == "":
+		return "from environment"
+	}
+	proxyURL, err := p.proxyURL()
+	if err != nil {
+		return "invalid"
+	}
+	return proxyURL.Redacted()
+}
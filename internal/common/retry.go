@@ -0,0 +1,176 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default retry settings of a datasource
+const (
+	DefaultMaxRetries     = 3
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+)
+
+// RetryConfig controls how requests rejected by an overloaded or briefly
+// unavailable Tempo are retried
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt (default: 3)
+	MaxRetries int `yaml:"max_retries,omitempty"`
+	// InitialBackoff is the delay before the first retry, doubled for each
+	// further retry up to MaxBackoff (defaults: 500ms and 10s)
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+	// Disabled sends every request only once
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// retryableStatus lists the responses that indicate a transient condition
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// maxRetries returns the number of retries after the first attempt
+func (r RetryConfig) maxRetries() int {
+	if r.Disabled {
+		return 0
+	}
+	if r.MaxRetries > 0 {
+		return r.MaxRetries
+	}
+	return DefaultMaxRetries
+}
+
+// maxBackoff returns the longest delay between two attempts
+func (r RetryConfig) maxBackoff() time.Duration {
+	if r.MaxBackoff > 0 {
+		return r.MaxBackoff
+	}
+	return DefaultMaxBackoff
+}
+
+// backoff returns the jittered delay before the given retry, starting at 1.
+// The delay is drawn from the upper half of the exponential backoff so that
+// concurrent clients spread out without retrying too early.
+func (r RetryConfig) backoff(retry int) time.Duration {
+	delay := r.InitialBackoff
+	if delay <= 0 {
+		delay = DefaultInitialBackoff
+	}
+	for i := 1; i < retry && delay < r.maxBackoff(); i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.maxBackoff())
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// validate checks that the backoff settings are consistent
+func (r RetryConfig) validate() error {
+	if r.MaxRetries < 0 || r.InitialBackoff < 0 || r.MaxBackoff < 0 {
+		return errors.New("max_retries, initial_backoff and max_backoff must not be negative")
+	}
+	if r.InitialBackoff > 0 && r.MaxBackoff > 0 && r.InitialBackoff > r.MaxBackoff {
+		return errors.New("initial_backoff must not exceed max_backoff")
+	}
+	return nil
+}
+
+// isRetryable reports whether a failed attempt may succeed when repeated:
+// responses with a retryable status, transient token endpoint failures and
+// connection failures. Anything else, such as an invalid URL, a request that
+// could not be built or a credential file that could not be read, fails the
+// same way again. Errors caused by the caller cancelling the request are
+// never retried.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return retryableStatus[httpErr.StatusCode]
+	}
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return !tokenErr.isPermanent()
+	}
+	return isConnectionFailure(err)
+}
+
+// isConnectionFailure reports whether Tempo could not be reached or dropped
+// the connection: refused or reset connections, truncated responses and
+// errors dialing or reading from Tempo. Timeouts and errors caused by the
+// connection settings are excluded, see isNonTransient.
+func isConnectionFailure(err error) bool {
+	if isNonTransient(err) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read")
+}
+
+// isNonTransient reports whether a request failed in a way that repeating it
+// does not fix and that says nothing about Tempo's health: timeouts, where
+// each attempt already took the full request timeout, and errors caused by
+// the connection settings such as untrusted certificates or unknown hosts
+func isNonTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return true
+	}
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		alertErr     tls.AlertError
+		recordErr    tls.RecordHeaderError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	return errors.As(err, &verifyErr) || errors.As(err, &alertErr) || errors.As(err, &recordErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// parseRetryAfter parses the Retry-After header, given either in seconds or
+// as an HTTP date, and returns zero when it is absent or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// timeoutError is a net.Error reporting a timeout, like the errors of an
+// http.Client whose timeout expired
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackoff(t *testing.T) {
+	retry := RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		retry int
+		upper time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := retry.backoff(tt.retry)
+			if delay < tt.upper/2 || delay > tt.upper {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.retry, delay, tt.upper/2, tt.upper)
+			}
+		}
+	}
+}
+
+func TestBackoffDefaults(t *testing.T) {
+	var retry RetryConfig
+	if got := retry.maxRetries(); got != DefaultMaxRetries {
+		t.Errorf("maxRetries() = %d, want %d", got, DefaultMaxRetries)
+	}
+	if delay := retry.backoff(1); delay < DefaultInitialBackoff/2 || delay > DefaultInitialBackoff {
+		t.Errorf("backoff(1) = %s, want between %s and %s", delay, DefaultInitialBackoff/2, DefaultInitialBackoff)
+	}
+	if delay := retry.backoff(100); delay > DefaultMaxBackoff {
+		t.Errorf("backoff(100) = %s, want at most %s", delay, DefaultMaxBackoff)
+	}
+
+	retry.Disabled = true
+	if got := retry.maxRetries(); got != 0 {
+		t.Errorf("maxRetries() of disabled retries = %d, want 0", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"0", 0},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+// requestSetupErrors returns the errors of a request that cannot be built
+// from a malformed URL and of credentials read from a missing secret file
+func requestSetupErrors(t *testing.T) (malformedURL, missingSecret error) {
+	t.Helper()
+	_, malformedURL = http.NewRequest(http.MethodGet, "http://tempo:port/api/search", nil)
+	_, missingSecret = AuthConfig{PasswordFile: filepath.Join(t.TempDir(), "missing")}.resolve()
+	if malformedURL == nil || missingSecret == nil {
+		t.Fatalf("expected errors, got %v and %v", malformedURL, missingSecret)
+	}
+	return malformedURL, missingSecret
+}
+
+func TestIsRetryable(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://tempo:3200", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}
+	malformedURL, missingSecret := requestSetupErrors(t)
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"service unavailable", &HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"too many requests", &HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad request", &HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{"internal server error", &HTTPError{StatusCode: http.StatusInternalServerError}, false},
+		{"connection refused", refused, true},
+		{"truncated response", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: io.ErrUnexpectedEOF}, true},
+		{"connection reset", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"malformed URL", malformedURL, false},
+		{"missing secret file", missingSecret, false},
+		{"unclassified error", errors.New("something went wrong"), false},
+		{"client timeout", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: timeoutError{}}, false},
+		{"unknown host", &url.Error{Op: "Get", URL: "http://tempo:3200", Err: &net.DNSError{Err: "no such host", Name: "tempo", IsNotFound: true}}, false},
+		{"untrusted certificate", &url.Error{Op: "Get", URL: "https://tempo", Err: x509.UnknownAuthorityError{}}, false},
+		{"token endpoint unavailable", &TokenError{Err: errors.New("connection reset")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(context.Background(), tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if isRetryable(ctx, refused) {
+		t.Error("isRetryable retried a request cancelled by the caller")
+	}
+}
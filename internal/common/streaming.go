@@ -0,0 +1,281 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/tempopb"
+)
+
+// DefaultStreamTimeout bounds streaming searches, which may run much longer
+// than the timeout of regular requests
+const DefaultStreamTimeout = 5 * time.Minute
+
+// pooledGRPCConn is the shared gRPC connection of a configured datasource
+// together with the settings it was built from
+type pooledGRPCConn struct {
+	conn     *grpc.ClientConn
+	settings string
+}
+
+var (
+	grpcConnsMu sync.Mutex
+	grpcConns   = map[string]*pooledGRPCConn{}
+)
+
+// StreamSearch runs a search over Tempo's gRPC streaming API and calls
+// onResponse for every partial response as shards of the search complete.
+// Tempo serves the API on its HTTP port when stream_over_http_enabled is set.
+func (c *TempoClient) StreamSearch(ctx context.Context, logger *log.Logger, req *tempopb.SearchRequest, onResponse func(*tempopb.SearchResponse) error) error {
+	ds := c.datasource
+	if ds.GrafanaDatasourceUID != "" {
+		return fmt.Errorf("streaming search is not available through the Grafana datasource proxy")
+	}
+
+	tenant, err := ParseTenant(ds.Tenant)
+	if err != nil {
+		return err
+	}
+
+	conn, release, err := grpcConnFor(ds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	authorization, err := c.authorization(ctx)
+	if err != nil {
+		return err
+	}
+	md := metadata.MD{}
+	if authorization != "" {
+		md.Set("authorization", authorization)
+	}
+	if tenant != "" {
+		logger.Printf("Using tenant: %s", tenant)
+		md.Set(strings.ToLower(TenantHeader), tenant)
+	}
+
+	if err := c.streamBreaker.allow(); err != nil {
+		return err
+	}
+
+	logger.Printf("Starting streaming search on datasource %s: %s", ds.Name, conn.Target())
+	streamCtx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, md), ds.streamTimeout())
+	defer cancel()
+
+	err = streamSearch(streamCtx, conn, req, onResponse)
+	c.streamBreaker.record(ctx, unhealthyStreamError(err))
+	if err != nil {
+		return describeStreamError(err)
+	}
+	return nil
+}
+
+// streamSearch sends the request and receives responses until the stream ends
+func streamSearch(ctx context.Context, conn *grpc.ClientConn, req *tempopb.SearchRequest, onResponse func(*tempopb.SearchResponse) error) error {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, tempopb.StreamingSearchMethod, grpc.ForceCodec(wireCodec{}))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		resp := &tempopb.SearchResponse{}
+		if err := stream.RecvMsg(resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := onResponse(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// grpcConnFor returns the gRPC connection of the datasource and a function
+// to call once the connection is no longer used. Configured datasources share
+// a connection, which is replaced when its TLS files change; URLs passed as
+// arguments get a connection of their own that release closes.
+func grpcConnFor(ds Datasource) (*grpc.ClientConn, func(), error) {
+	if ds.adHoc {
+		conn, err := newGRPCConn(ds)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, func() { conn.Close() }, nil
+	}
+
+	settings := ds.connectionSettings()
+
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	pooled, ok := grpcConns[ds.Name]
+	if !ok || pooled.settings != settings {
+		conn, err := newGRPCConn(ds)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			// Let searches still running on the old connection finish
+			old := pooled.conn
+			time.AfterFunc(ds.streamTimeout(), func() { old.Close() })
+		}
+		pooled = &pooledGRPCConn{conn: conn, settings: settings}
+		grpcConns[ds.Name] = pooled
+	}
+	return pooled.conn, func() {}, nil
+}
+
+// newGRPCConn creates a gRPC connection to the host and port of the
+// datasource URL
+func newGRPCConn(ds Datasource) (*grpc.ClientConn, error) {
+	u, err := url.Parse(ds.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url for datasource %s: %v", ds.Name, err)
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("streaming search requires Tempo to be served at the root of its URL, not under %s", u.Path)
+	}
+	if ds.Proxy.URL != "" {
+		return nil, fmt.Errorf("streaming search does not support the proxy settings of datasource %s", ds.Name)
+	}
+
+	target := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		target = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	opts := []grpc.DialOption{}
+	if u.Scheme == "https" {
+		tlsConfig, err := ds.TLS.clientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration for datasource %s: %v", ds.Name, err)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if ds.Proxy.Disabled {
+		opts = append(opts, grpc.WithNoProxy())
+	}
+
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client for datasource %s: %v", ds.Name, err)
+	}
+	return conn, nil
+}
+
+// resetGRPCConns closes the shared gRPC connections, e.g. after the
+// configuration changed
+func resetGRPCConns() {
+	grpcConnsMu.Lock()
+	defer grpcConnsMu.Unlock()
+	for name, pooled := range grpcConns {
+		pooled.conn.Close()
+		delete(grpcConns, name)
+	}
+}
+
+// unhealthyStreamError returns the error if it indicates an unhealthy
+// datasource, so that rejected queries, searches that ran into the stream
+// timeout and cancelled searches do not open the circuit breaker
+func unhealthyStreamError(err error) error {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.Unimplemented, codes.Unauthenticated, codes.PermissionDenied, codes.NotFound,
+		codes.DeadlineExceeded, codes.Canceled:
+		return nil
+	}
+	return err
+}
+
+// isStreamFailure reports whether the error is the gRPC status of a failed
+// streaming search. Such errors are only recorded by the circuit breaker when
+// unhealthyStreamError kept them.
+func isStreamFailure(err error) bool {
+	_, ok := status.FromError(err)
+	return ok
+}
+
+// describeStreamError adds hints to the gRPC errors caused by a Tempo that
+// does not serve the streaming API
+func describeStreamError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.Unimplemented, codes.Unavailable:
+		return fmt.Errorf("streaming search failed: %s (Tempo must have stream_over_http_enabled set, or the url must point at its gRPC port)", st.Message())
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("streaming search timed out: %s", st.Message())
+	}
+	return fmt.Errorf("streaming search failed: %s: %s", st.Code(), st.Message())
+}
+
+// streamBreakerName names the circuit breaker of the datasource's streaming
+// searches in the errors it returns
+func (d Datasource) streamBreakerName() string {
+	return d.Name + " (streaming)"
+}
+
+// streamTimeout returns the timeout of streaming searches of the datasource
+func (d Datasource) streamTimeout() time.Duration {
+	if d.StreamTimeout > 0 {
+		return d.StreamTimeout
+	}
+	return DefaultStreamTimeout
+}
+
+// wireCodec marshals the hand-written tempopb messages
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(interface{ Marshal() ([]byte, error) })
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.Marshal()
+}
+
+func (wireCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(interface{ Unmarshal([]byte) error })
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
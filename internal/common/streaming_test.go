@@ -0,0 +1,85 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/tempopb"
+)
+
+func TestStreamFailuresDoNotBlockHTTP(t *testing.T) {
+	// A plain HTTP server, like a Tempo without stream_over_http_enabled
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"traces": []}`))
+	}))
+	defer server.Close()
+	resetClients()
+	defer resetClients()
+
+	ds := Datasource{
+		Name:           "stream-test",
+		URL:            server.URL,
+		Retry:          RetryConfig{Disabled: true},
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 1},
+	}
+	client, err := NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	logger := log.New(io.Discard, "", 0)
+	ctx := context.Background()
+	search := func() error {
+		return client.StreamSearch(ctx, logger, &tempopb.SearchRequest{Query: "{}"}, func(*tempopb.SearchResponse) error { return nil })
+	}
+
+	if err := search(); err == nil {
+		t.Fatal("streaming search against a plain HTTP server succeeded")
+	}
+	var openErr *CircuitOpenError
+	if err := search(); !errors.As(err, &openErr) {
+		t.Fatalf("second streaming search returned %v, want an open circuit", err)
+	}
+
+	// A new client for the same datasource shares the breakers
+	client, err = NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	body, err := client.Get(ctx, logger, func(base string) (string, error) { return base + "/api/search", nil })
+	if err != nil {
+		t.Fatalf("HTTP request after failed streams: %v", err)
+	}
+	if string(body) != `{"traces": []}` {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestUnhealthyStreamError(t *testing.T) {
+	tests := []struct {
+		code      codes.Code
+		unhealthy bool
+	}{
+		{codes.Unavailable, true},
+		{codes.Internal, true},
+		{codes.ResourceExhausted, true},
+		{codes.InvalidArgument, false},
+		{codes.Unimplemented, false},
+		{codes.Unauthenticated, false},
+		{codes.DeadlineExceeded, false},
+		{codes.Canceled, false},
+	}
+	for _, tt := range tests {
+		err := status.Error(tt.code, "failed")
+		if got := unhealthyStreamError(err) != nil; got != tt.unhealthy {
+			t.Errorf("unhealthyStreamError(%s) unhealthy = %v, want %v", tt.code, got, tt.unhealthy)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variables holding the TLS settings of the default datasource
+const (
+	EnvTempoTLSCAFile             = "TEMPO_TLS_CA_FILE"
+	EnvTempoTLSCertFile           = "TEMPO_TLS_CERT_FILE"
+	EnvTempoTLSKeyFile            = "TEMPO_TLS_KEY_FILE"
+	EnvTempoTLSServerName         = "TEMPO_TLS_SERVER_NAME"
+	EnvTempoTLSInsecureSkipVerify = "TEMPO_TLS_INSECURE_SKIP_VERIFY"
+)
+
+// tlsFromEnv builds the TLS settings of the default datasource from the environment
+func tlsFromEnv() TLSConfig {
+	return TLSConfig{
+		CAFile:             os.Getenv(EnvTempoTLSCAFile),
+		CertFile:           os.Getenv(EnvTempoTLSCertFile),
+		KeyFile:            os.Getenv(EnvTempoTLSKeyFile),
+		ServerName:         os.Getenv(EnvTempoTLSServerName),
+		InsecureSkipVerify: strings.EqualFold(os.Getenv(EnvTempoTLSInsecureSkipVerify), "true"),
+	}
+}
+
+// validate checks that the client certificate is configured completely
+func (c TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// clientConfig builds the TLS client configuration of a datasource, or
+// returns nil when the defaults apply
+func (c TLSConfig) clientConfig() (*tls.Config, error) {
+	if c == (TLSConfig{}) {
+		return nil, nil
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	// Custom CAs extend the system roots, so a bundle only needs to contain
+	// the internal CAs
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Client certificate for mutual TLS
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// filesVersion identifies the current contents of the CA, certificate and key
+// files by their size and modification time, so that changed files can be
+// detected without reading them
+func (c TLSConfig) filesVersion() string {
+	var version strings.Builder
+	for _, path := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&version, "%d@%d ", info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return version.String()
+}
@@ -0,0 +1,268 @@
+package common
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA for the given usage
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes the contents to a file in dir and returns its path
+func writeFile(t *testing.T, dir, name string, contents []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "tempo-mcp", x509.ExtKeyUsageClientAuth)
+	_, otherKeyPEM := ca.issue(t, "other", x509.ExtKeyUsageClientAuth)
+
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	certFile := writeFile(t, dir, "client.pem", certPEM)
+	keyFile := writeFile(t, dir, "client-key.pem", keyPEM)
+	otherKeyFile := writeFile(t, dir, "other-key.pem", otherKeyPEM)
+	emptyFile := writeFile(t, dir, "empty.pem", nil)
+	missingFile := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr string
+		check   func(t *testing.T, config *tls.Config)
+	}{
+		{name: "defaults", config: TLSConfig{}, check: func(t *testing.T, config *tls.Config) {
+			if config != nil {
+				t.Errorf("config = %+v, want nil for the defaults", config)
+			}
+		}},
+		{name: "server name", config: TLSConfig{ServerName: "tempo.internal", InsecureSkipVerify: true}, check: func(t *testing.T, config *tls.Config) {
+			if config.ServerName != "tempo.internal" || !config.InsecureSkipVerify || config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("config = %+v", config)
+			}
+		}},
+		{name: "CA", config: TLSConfig{CAFile: caFile}, check: func(t *testing.T, config *tls.Config) {
+			if config.RootCAs == nil {
+				t.Fatal("CA was not loaded")
+			}
+			if _, err := ca.cert.Verify(x509.VerifyOptions{Roots: config.RootCAs}); err != nil {
+				t.Errorf("CA is not trusted: %v", err)
+			}
+			if len(config.Certificates) != 0 {
+				t.Error("client certificate configured without cert_file")
+			}
+		}},
+		{name: "mutual TLS", config: TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, check: func(t *testing.T, config *tls.Config) {
+			if len(config.Certificates) != 1 {
+				t.Fatalf("config has %d client certificates, want 1", len(config.Certificates))
+			}
+		}},
+		{name: "cert without key", config: TLSConfig{CertFile: certFile}, wantErr: "must be set together"},
+		{name: "key without cert", config: TLSConfig{KeyFile: keyFile}, wantErr: "must be set together"},
+		{name: "missing CA file", config: TLSConfig{CAFile: missingFile}, wantErr: "failed to read CA file"},
+		{name: "CA file without certificates", config: TLSConfig{CAFile: emptyFile}, wantErr: "no certificates found"},
+		{name: "missing key file", config: TLSConfig{CertFile: certFile, KeyFile: missingFile}, wantErr: "failed to load client certificate"},
+		{name: "key of another certificate", config: TLSConfig{CertFile: certFile, KeyFile: otherKeyFile}, wantErr: "failed to load client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.config.clientConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("clientConfig returned %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("clientConfig: %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert, serverKey := ca.issue(t, "tempo", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "tempo-mcp", x509.ExtKeyUsageClientAuth)
+
+	certificate, err := tls.X509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	tempo := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"traces": []}`))
+	}))
+	tempo.TLS = &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	tempo.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tempo.StartTLS()
+	defer tempo.Close()
+	resetClients()
+	defer resetClients()
+
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr bool
+	}{
+		{"client certificate", TLSConfig{CAFile: caFile, CertFile: writeFile(t, dir, "client.pem", clientCert), KeyFile: writeFile(t, dir, "client-key.pem", clientKey)}, false},
+		{"no client certificate", TLSConfig{CAFile: caFile}, true},
+		{"untrusted server", TLSConfig{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewTempoClient(Datasource{Name: tt.name, URL: tempo.URL, TLS: tt.tls, Retry: RetryConfig{Disabled: true}})
+			if err != nil {
+				t.Fatalf("NewTempoClient: %v", err)
+			}
+			_, err = client.Get(context.Background(), log.New(io.Discard, "", 0), func(base string) (string, error) { return base + "/api/search", nil })
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get returned %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSFilesVersion(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "tempo-mcp", x509.ExtKeyUsageClientAuth)
+	config := TLSConfig{
+		CAFile:   writeFile(t, dir, "ca.pem", ca.pem),
+		CertFile: writeFile(t, dir, "client.pem", certPEM),
+		KeyFile:  writeFile(t, dir, "client-key.pem", keyPEM),
+	}
+	version := config.filesVersion()
+	if version == "" || config.filesVersion() != version {
+		t.Fatalf("filesVersion = %q, want a stable version of the files", version)
+	}
+	if got := (TLSConfig{}).filesVersion(); got != "" {
+		t.Errorf("filesVersion without files = %q, want empty", got)
+	}
+
+	// Rotating the certificate changes the version and rebuilds the pooled client
+	resetClients()
+	defer resetClients()
+	ds := Datasource{Name: "rotated", URL: "https://tempo:3200", TLS: config}
+	first, err := NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	same, err := NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	if same.httpClient != first.httpClient {
+		t.Error("client was rebuilt although the files did not change")
+	}
+
+	certPEM, keyPEM = ca.issue(t, "tempo-mcp", x509.ExtKeyUsageClientAuth)
+	writeFile(t, dir, "client.pem", certPEM)
+	writeFile(t, dir, "client-key.pem", keyPEM)
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{config.CertFile, config.KeyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if config.filesVersion() == version {
+		t.Error("filesVersion did not change after the certificate was rotated")
+	}
+	rotated, err := NewTempoClient(ds)
+	if err != nil {
+		t.Fatalf("NewTempoClient: %v", err)
+	}
+	if rotated.httpClient == first.httpClient {
+		t.Error("client was not rebuilt after the certificate was rotated")
+	}
+}
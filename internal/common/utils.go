@@ -3,12 +3,8 @@ package common
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
-	"net"
-	"net/http"
-	"net/url"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -20,117 +16,148 @@ const EnvTempoURL = "TEMPO_URL"
 // Default Tempo URL when environment variable is not set
 const DefaultTempoURL = "http://localhost:3200"
 
+// Environment variable name for the default Tempo tenant
+const EnvTempoTenant = "TEMPO_TENANT"
+
+// Header used by Tempo to select the tenant in multi-tenant deployments
+const TenantHeader = "X-Scope-OrgID"
+
+// HTTPError is returned by MakeTempoRequest when Tempo responds with a non-200 status
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the delay requested by the Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP error: %d - %s", e.StatusCode, e.Body)
+}
+
+// ConnectionParams returns the tool options selecting the Tempo datasource and
+// overriding its connection settings
 func ConnectionParams() []mcp.ToolOption {
-	tempoURL := os.Getenv(EnvTempoURL)
-	if tempoURL == "" {
-		tempoURL = DefaultTempoURL
+	cfg := currentConfig()
+	defaultDatasource, _ := cfg.Datasource("")
+
+	tenantDescription := fmt.Sprintf("Tenant ID sent as %s for multi-tenant Tempo; separate several tenants with | to query across them", TenantHeader)
+	if defaultDatasource.Tenant != "" {
+		tenantDescription += fmt.Sprintf(" (default: %s)", defaultDatasource.Tenant)
 	}
-	return []mcp.ToolOption{
-	mcp.WithString("url",
-		mcp.Description(fmt.Sprintf("Tempo server URL (default: %s from %s env var)", tempoURL, EnvTempoURL)),
-		mcp.DefaultString(tempoURL),
-	),
-	mcp.WithString("username",
-		mcp.Description("Username for basic authentication"),
-	),
-	mcp.WithString("password",
-		mcp.Description("Password for basic authentication"),
-	),
-	mcp.WithString("token",
-			mcp.Description("Bearer token for authentication"),
+
+	params := []mcp.ToolOption{
+		mcp.WithString("datasource",
+			mcp.Description(fmt.Sprintf("Name of the Tempo datasource to query (default: %s)", defaultDatasource.Name)),
+			mcp.Enum(cfg.Names()...),
+		),
+		mcp.WithString("url",
+			mcp.Description(fmt.Sprintf("Tempo server URL, overriding the datasource URL (default: %s)", defaultDatasource.URL)),
+		),
+		mcp.WithString("tenant",
+			mcp.Description(tenantDescription),
 		),
 	}
-}
 
-func MakeTempoRequest(ctx context.Context, logger *log.Logger, toolRequest mcp.CallToolRequest, makeQueryURL func(string) (string, error)) ([]byte, error) {
-	// Get Tempo URL from request arguments, if not present check environment
-	var tempoURL string
-	if urlArg, ok := toolRequest.Params.Arguments["url"].(string); ok && urlArg != "" {
-		tempoURL = urlArg
-	} else {
-		// Fallback to environment variable
-		tempoURL = os.Getenv(EnvTempoURL)
-		if tempoURL == "" {
-			tempoURL = DefaultTempoURL
-		}
+	// Credentials are configured server-side only
+	if cfg.hideAuthParams() {
+		return params
 	}
-	logger.Printf("Using Tempo URL: %s", tempoURL)
 
-	// Extract authentication parameters
-	var username, password, token string
-	if usernameArg, ok := toolRequest.Params.Arguments["username"].(string); ok {
-		username = usernameArg
-	}
-	if passwordArg, ok := toolRequest.Params.Arguments["password"].(string); ok {
-		password = passwordArg
-	}
-	if tokenArg, ok := toolRequest.Params.Arguments["token"].(string); ok {
-		token = tokenArg
-	}
+	return append(params,
+		mcp.WithString("username",
+			mcp.Description("Username for basic authentication (only needed if no credentials are configured for the datasource)"),
+		),
+		mcp.WithString("password",
+			mcp.Description("Password for basic authentication (only needed if no credentials are configured for the datasource)"),
+		),
+		mcp.WithString("token",
+			mcp.Description("Bearer token for authentication (only needed if no credentials are configured for the datasource)"),
+		),
+	)
+}
 
-	// Create HTTP request
-	proxyAddr := os.Getenv("HTTP_PROXY")
-	var transport *http.Transport
-	if proxyAddr != "" {
-		logger.Printf("Using HTTP_PROXY: %s", proxyAddr)
-		proxyURL, err := url.Parse("http://" + proxyAddr)
-		if err != nil {
-			logger.Printf("ERROR parsing HTTP_PROXY: %v", err)
-		}
-		transport = &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				// Always connect to proxy
-				dialer := &net.Dialer{Timeout: 10 * time.Second}
-				return dialer.DialContext(ctx, "tcp", proxyAddr)
-			},
-		}
-	}
+// ResolveDatasource returns the datasource selected by the tool request, with
+// any connection settings passed as arguments applied on top. Server-side
+// credentials, including TLS client certificates, are resolved here and are
+// never sent to a URL passed as an argument.
+func ResolveDatasource(toolRequest mcp.CallToolRequest) (Datasource, error) {
+	args := toolRequest.GetArguments()
+	cfg := currentConfig()
 
-	queryURL, err := makeQueryURL(tempoURL)
+	name, _ := args["datasource"].(string)
+	ds, err := cfg.Datasource(name)
 	if err != nil {
-		return nil, err
+		return Datasource{}, err
 	}
 
-	logger.Printf("Executing Tempo query: %s", queryURL)
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	if urlArg, ok := args["url"].(string); ok && urlArg != "" && urlArg != ds.URL {
+		// The url argument always addresses Tempo directly. Client
+		// certificates, trusted CAs and the proxy (with its credentials) are
+		// configured for the datasource's own host and are not used either.
+		ds.URL = urlArg
+		ds.GrafanaDatasourceUID = ""
+		ds.Auth = AuthConfig{}
+		ds.TLS = TLSConfig{}
+		ds.Proxy = ProxyConfig{}
+		ds.adHoc = true
+	}
+
+	ds.Auth, err = ds.Auth.resolve()
 	if err != nil {
-		return nil, err
+		return Datasource{}, fmt.Errorf("failed to resolve credentials for datasource %s: %v", ds.Name, err)
 	}
 
-	// Add authentication if provided
-	if token != "" {
-		// Bearer token authentication
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		// Basic authentication
-		req.SetBasicAuth(username, password)
+	if !cfg.hideAuthParams() {
+		credentialArgs := false
+		if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
+			ds.Auth.Username = usernameArg
+			credentialArgs = true
+		}
+		if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
+			ds.Auth.Password = passwordArg
+			credentialArgs = true
+		}
+		if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
+			ds.Auth.Token = tokenArg
+			credentialArgs = true
+		}
+		// Credentials passed as arguments replace the OAuth2 client
+		if credentialArgs {
+			ds.Auth.OAuth2 = nil
+		}
 	}
 
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: transport,
+	if tenantArg, ok := args["tenant"].(string); ok && tenantArg != "" {
+		ds.Tenant = tenantArg
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	return ds, nil
+}
+
+// ParseTenant normalizes a tenant argument to the X-Scope-OrgID header value.
+// Multiple tenants may be separated by | (Tempo's cross-tenant syntax) or by
+// commas, and are joined with |.
+func ParseTenant(value string) (string, error) {
+	var tenants []string
+	for _, tenant := range strings.FieldsFunc(value, func(r rune) bool { return r == '|' || r == ',' }) {
+		tenant = strings.TrimSpace(tenant)
+		if tenant == "" {
+			continue
+		}
+		if strings.ContainsAny(tenant, " \t\r\n") {
+			return "", fmt.Errorf("invalid tenant %q: tenant IDs must not contain whitespace", tenant)
+		}
+		tenants = append(tenants, tenant)
 	}
-	defer resp.Body.Close()
+	return strings.Join(tenants, "|"), nil
+}
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+// MakeTempoRequest sends a GET request to the datasource selected by the tool
+// request using its shared client, see TempoClient.Get
+func MakeTempoRequest(ctx context.Context, logger *log.Logger, toolRequest mcp.CallToolRequest, makeQueryURL func(string) (string, error)) ([]byte, error) {
+	client, err := ClientForRequest(toolRequest)
 	if err != nil {
 		return nil, err
 	}
-
-	// Check for HTTP errors
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
-	}
-
-	// Log to stderr instead of stdout
-	logger.Printf("Tempo raw response length: %d bytes", len(body))
-	return body, nil
+	return client.Get(ctx, logger, makeQueryURL)
 }
@@ -0,0 +1,37 @@
+package common
+
+import "testing"
+
+func TestParseTenant(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"team-a", "team-a"},
+		{"  team-a  ", "team-a"},
+		{"team-a|team-b", "team-a|team-b"},
+		{"team-a,team-b", "team-a|team-b"},
+		{"team-a, team-b | team-c", "team-a|team-b|team-c"},
+		{"team-a||,team-b,", "team-a|team-b"},
+		{" | , ", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseTenant(tt.value)
+		if err != nil {
+			t.Errorf("ParseTenant(%q): %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTenant(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseTenantInvalid(t *testing.T) {
+	for _, value := range []string{"team a", "team-a|team\tb", "team-a,team\r\nX-Injected: 1"} {
+		if got, err := ParseTenant(value); err == nil {
+			t.Errorf("ParseTenant(%q) = %q, want error", value, got)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package eventstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Handler wraps the streamable HTTP handler so that the SSE streams of a
+// session can be resumed:
+//
+//   - every event of an SSE response gets an ID and is kept in the store
+//   - a GET request with a Last-Event-ID header replays the events that
+//     followed that event on its stream, then carries on with the stream: a
+//     listening stream keeps delivering server-initiated messages, the stream
+//     of a POST request ends with its response
+//   - a POST request whose response was upgraded to an SSE stream keeps
+//     running when the client disconnects, so that its response can be
+//     replayed; disconnecting before that still cancels the request
+//   - a DELETE request drops the events of the session
+//
+// Requests without a session, as in stateless mode, are passed through.
+func (s *Store) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := r.Header.Get(server.HeaderKeySessionID)
+		if session == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if eventID := r.Header.Get(HeaderLastEventID); eventID != "" {
+				if s.resume(w, r, session, eventID, next) {
+					return
+				}
+				logger.Printf("Cannot resume stream of session %s after event %q: unknown or expired, opening a new stream", session, eventID)
+			}
+			s.serve(w, r, session, true, next)
+		case http.MethodPost:
+			s.servePost(w, r, session, next)
+		case http.MethodDelete:
+			next.ServeHTTP(w, r)
+			s.dropSession(session)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serve handles a request whose SSE response is recorded as a new stream
+func (s *Store) serve(w http.ResponseWriter, r *http.Request, session string, listening bool, next http.Handler) {
+	sw := &streamWriter{ResponseWriter: w, store: s, session: session, listening: listening, conn: &conn{w: w}}
+	defer sw.close()
+	next.ServeHTTP(sw, r)
+}
+
+// servePost handles a POST request. Once its response has been upgraded to a
+// resumable SSE stream the request is detached from the connection: the MCP
+// specification does not treat a disconnection as a cancellation, and the
+// client can collect the response by resuming the stream. Clients cancel
+// requests with notifications/cancelled.
+func (s *Store) servePost(w http.ResponseWriter, r *http.Request, session string, next http.Handler) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	sw := &streamWriter{ResponseWriter: w, store: s, session: session, conn: &conn{w: w}}
+	defer sw.close()
+
+	stop := context.AfterFunc(r.Context(), func() {
+		if !sw.opened.Load() {
+			cancel()
+		}
+	})
+	defer stop()
+
+	next.ServeHTTP(sw, r.WithContext(ctx))
+}
+
+// resume handles a GET request resuming the stream of the event. It returns
+// false, without writing a response, when the stream cannot be resumed.
+func (s *Store) resume(w http.ResponseWriter, r *http.Request, session, eventID string, next http.Handler) bool {
+	st, after, ok := s.lookup(session, eventID)
+	if !ok {
+		return false
+	}
+	c := &conn{w: w}
+	if !st.attach(c, after) {
+		return false
+	}
+	defer st.detach(c, s.now())
+
+	if st.listening {
+		sw := &streamWriter{ResponseWriter: w, store: s, session: session, listening: true, conn: c, stream: st}
+		sw.opened.Store(true)
+		next.ServeHTTP(sw, r)
+		return true
+	}
+
+	// The stream of a POST request carries nothing but the messages of that
+	// request, so the connection is held until the request completes
+	select {
+	case <-st.done:
+	case <-r.Context().Done():
+	}
+	return true
+}
+
+// streamWriter records the events of an SSE response. Other responses are
+// passed through.
+type streamWriter struct {
+	http.ResponseWriter
+	store     *Store
+	session   string
+	listening bool
+	conn      *conn
+
+	// stream is set once the response turned out to be an SSE stream, or
+	// upfront when a stream is resumed
+	stream *stream
+	opened atomic.Bool
+	// pending holds a partially written event
+	pending []byte
+}
+
+// WriteHeader opens a stream when the response is an SSE stream. The headers
+// of a resumed stream have been sent already.
+func (w *streamWriter) WriteHeader(code int) {
+	if w.stream != nil {
+		return
+	}
+	if code == http.StatusOK && isEventStream(w.Header()) {
+		w.stream = w.store.open(w.session, w.listening, w.conn)
+		w.opened.Store(true)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write records every complete event written to an SSE stream. Events are
+// kept even when the client has disconnected, so the write does not fail.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.stream == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.Index(w.pending, []byte("\n\n"))
+		if end < 0 {
+			break
+		}
+		w.stream.record(w.pending[:end+2], w.store.now())
+		w.pending = w.pending[end+2:]
+	}
+	return len(p), nil
+}
+
+// Flush implements http.Flusher, which mcp-go requires for streaming
+func (w *streamWriter) Flush() {
+	if w.stream != nil {
+		w.stream.flush()
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close detaches the connection from the stream once the request returns
+func (w *streamWriter) close() {
+	if w.stream == nil {
+		return
+	}
+	w.stream.detach(w.conn, w.store.now())
+	if !w.listening {
+		close(w.stream.done)
+	}
+}
+
+// conn is the connection of a request that events are delivered to
+type conn struct {
+	w http.ResponseWriter
+}
+
+// start sends the headers of a resumed SSE stream
+func (c *conn) start() {
+	h := c.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	c.w.WriteHeader(http.StatusOK)
+}
+
+// send writes the event with its ID, reporting whether the client is still
+// reachable
+func (c *conn) send(streamID string, ev event) bool {
+	if _, err := fmt.Fprintf(c.w, "id: %s-%d\n", streamID, ev.seq); err != nil {
+		return false
+	}
+	_, err := c.w.Write(ev.data)
+	if err != nil {
+		return false
+	}
+	c.flush()
+	return true
+}
+
+// flush flushes the events written so far
+func (c *conn) flush() {
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// isEventStream reports whether the response is an SSE stream
+func isEventStream(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
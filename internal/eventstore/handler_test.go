@@ -0,0 +1,342 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var eventIDPattern = regexp.MustCompile(`id: (\S+)\n`)
+
+// writeEvents starts an SSE response, unless started already, and writes the
+// events the way mcp-go does
+func writeEvents(w http.ResponseWriter, start bool, data ...string) {
+	if start {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+	}
+	for _, d := range data {
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", d)
+		w.(http.Flusher).Flush()
+	}
+}
+
+// newRequest returns a request of the session, resuming after the event if
+// one is given
+func newRequest(method, session, lastEventID string) *http.Request {
+	r := httptest.NewRequest(method, "/mcp", nil)
+	if session != "" {
+		r.Header.Set(server.HeaderKeySessionID, session)
+	}
+	if lastEventID != "" {
+		r.Header.Set(HeaderLastEventID, lastEventID)
+	}
+	return r
+}
+
+// eventIDs returns the IDs of the events of an SSE response
+func eventIDs(body string) []string {
+	var ids []string
+	for _, m := range eventIDPattern.FindAllStringSubmatch(body, -1) {
+		ids = append(ids, m[1])
+	}
+	return ids
+}
+
+func TestEventIDs(t *testing.T) {
+	store := NewStore(time.Minute)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, true, "one", "two")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, "session", ""))
+	ids := eventIDs(rec.Body.String())
+	if len(ids) != 2 {
+		t.Fatalf("response has event IDs %v, want 2:\n%s", ids, rec.Body)
+	}
+	stream, _, _ := strings.Cut(ids[0], "-")
+	if ids[0] != stream+"-1" || ids[1] != stream+"-2" {
+		t.Errorf("event IDs = %v, want consecutive IDs of one stream", ids)
+	}
+	if !strings.Contains(rec.Body.String(), "id: "+ids[1]+"\nevent: message\ndata: two\n\n") {
+		t.Errorf("event is not written with its ID:\n%s", rec.Body)
+	}
+}
+
+func TestNoRecordingWithoutSession(t *testing.T) {
+	store := NewStore(time.Minute)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, true, "one")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, "", ""))
+	if ids := eventIDs(rec.Body.String()); len(ids) != 0 {
+		t.Errorf("stateless response has event IDs %v", ids)
+	}
+	if len(store.streams) != 0 {
+		t.Errorf("store has %d streams, want none", len(store.streams))
+	}
+}
+
+func TestJSONResponsesArePassedThrough(t *testing.T) {
+	store := NewStore(time.Minute)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "{}\n\n")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, "session", ""))
+	if rec.Body.String() != "{}\n\n" || len(store.streams) != 0 {
+		t.Errorf("JSON response was recorded: %q", rec.Body)
+	}
+}
+
+func TestResumeCompletedRequestStream(t *testing.T) {
+	store := NewStore(time.Minute)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeEvents(w, true, "new stream")
+			return
+		}
+		writeEvents(w, true, "progress", "result")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, "session", ""))
+	first := eventIDs(rec.Body.String())[0]
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, "session", first))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("resumed stream has status %d and content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if strings.Contains(body, "progress") || !strings.Contains(body, "data: result") || strings.Contains(body, "new stream") {
+		t.Errorf("resumed stream = %q, want the result only", body)
+	}
+}
+
+func TestResumeInFlightRequestStream(t *testing.T) {
+	store := NewStore(time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, true, "progress")
+		close(started)
+		<-release
+		cancelled <- r.Context().Err() != nil
+		writeEvents(w, false, "result")
+	}))
+
+	// The client disconnects after the first event
+	ctx, disconnect := context.WithCancel(context.Background())
+	post := httptest.NewRecorder()
+	postDone := make(chan struct{})
+	go func() {
+		defer close(postDone)
+		handler.ServeHTTP(post, newRequest(http.MethodPost, "session", "").WithContext(ctx))
+	}()
+	<-started
+	first := eventIDs(post.Body.String())[0]
+	disconnect()
+
+	get := httptest.NewRecorder()
+	getDone := make(chan struct{})
+	go func() {
+		defer close(getDone)
+		handler.ServeHTTP(get, newRequest(http.MethodGet, "session", first))
+	}()
+
+	// The result is written once the resuming client is attached
+	for {
+		store.mu.Lock()
+		var active int
+		for _, st := range store.streams {
+			st.mu.Lock()
+			active = st.active
+			st.mu.Unlock()
+		}
+		store.mu.Unlock()
+		if active == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-postDone
+	<-getDone
+
+	if <-cancelled {
+		t.Error("request was cancelled by the disconnection after the stream started")
+	}
+	if strings.Contains(post.Body.String(), "result") {
+		t.Errorf("result was delivered to the disconnected client: %q", post.Body)
+	}
+	stream, _, _ := strings.Cut(first, "-")
+	if ids := eventIDs(get.Body.String()); len(ids) != 1 || ids[0] != stream+"-2" || !strings.Contains(get.Body.String(), "data: result") {
+		t.Errorf("resumed stream = %q, want the result as event %s-2", get.Body, stream)
+	}
+}
+
+func TestDisconnectBeforeStreamCancels(t *testing.T) {
+	store := NewStore(time.Minute)
+	cancelled := make(chan bool, 1)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+	}))
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	disconnect()
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "session", "").WithContext(ctx))
+	if !<-cancelled {
+		t.Error("request was not cancelled by the disconnection")
+	}
+}
+
+func TestResumeListeningStream(t *testing.T) {
+	store := NewStore(time.Minute)
+	var calls int
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeEvents(w, true, fmt.Sprintf("message %d", calls))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, "session", ""))
+	first := eventIDs(rec.Body.String())[0]
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, "session", first))
+	stream, _, _ := strings.Cut(first, "-")
+	if ids := eventIDs(rec.Body.String()); len(ids) != 1 || ids[0] != stream+"-2" {
+		t.Errorf("resumed stream has event IDs %v, want the stream continued at %s-2", ids, stream)
+	}
+	if !strings.Contains(rec.Body.String(), "data: message 2") {
+		t.Errorf("resumed stream = %q, want the new message", rec.Body)
+	}
+}
+
+func TestResumeRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare runs between the request and its resumption
+		prepare func(store *Store, handler http.Handler)
+		session string
+		eventID func(id string) string
+	}{
+		{
+			name:    "other session",
+			session: "other",
+		},
+		{
+			name:    "unknown stream",
+			session: "session",
+			eventID: func(string) string { return "0123456789abcdef-1" },
+		},
+		{
+			name:    "malformed event ID",
+			session: "session",
+			eventID: func(string) string { return "garbage" },
+		},
+		{
+			name:    "event not sent yet",
+			session: "session",
+			eventID: func(id string) string {
+				stream, _, _ := strings.Cut(id, "-")
+				return stream + "-9"
+			},
+		},
+		{
+			name: "expired",
+			prepare: func(store *Store, handler http.Handler) {
+				now := time.Now().Add(2 * time.Minute)
+				store.now = func() time.Time { return now }
+			},
+			session: "session",
+		},
+		{
+			name: "session deleted",
+			prepare: func(store *Store, handler http.Handler) {
+				handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodDelete, "session", ""))
+			},
+			session: "session",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(time.Minute)
+			handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					writeEvents(w, true, "new stream")
+					return
+				}
+				writeEvents(w, true, "progress", "result")
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, newRequest(http.MethodPost, "session", ""))
+			id := eventIDs(rec.Body.String())[0]
+			if tt.eventID != nil {
+				id = tt.eventID(id)
+			}
+			if tt.prepare != nil {
+				tt.prepare(store, handler)
+			}
+
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, newRequest(http.MethodGet, tt.session, id))
+			if body := rec.Body.String(); strings.Contains(body, "result") || !strings.Contains(body, "new stream") {
+				t.Errorf("resumption = %q, want a new stream", body)
+			}
+		})
+	}
+}
+
+func TestResumeAfterDroppedEvents(t *testing.T) {
+	store := NewStore(time.Minute)
+	handler := store.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeEvents(w, true, "new stream")
+			return
+		}
+		writeEvents(w, true)
+		for i := range maxEvents + 2 {
+			writeEvents(w, false, fmt.Sprint(i))
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodPost, "session", ""))
+	ids := eventIDs(rec.Body.String())
+
+	// The first two events were dropped, so the client can resume after the
+	// second one at the earliest
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, "session", ids[0]))
+	if !strings.Contains(rec.Body.String(), "new stream") {
+		t.Errorf("resumed a stream with missing events")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest(http.MethodGet, "session", ids[1]))
+	if got := eventIDs(rec.Body.String()); len(got) != maxEvents {
+		t.Errorf("replayed %d events, want %d", len(got), maxEvents)
+	}
+}
@@ -0,0 +1,243 @@
+// Package eventstore makes the SSE streams of the streamable HTTP transport
+// resumable. The MCP specification lets a client whose stream broke reconnect
+// with a GET request carrying the ID of the last event it received in the
+// Last-Event-ID header, upon which the server replays the events the client
+// missed on that stream. mcp-go neither numbers nor keeps the events it sends,
+// so the store wraps its handler: it assigns an ID to every event of the SSE
+// responses of a session, keeps the events for a while and replays them when
+// the client reconnects.
+package eventstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = log.New(os.Stderr, "[tempo-mcp] ", log.LstdFlags)
+
+// DefaultRetention is how long the events of a stream are kept after its last
+// event was sent or its last connection closed
+const DefaultRetention = 5 * time.Minute
+
+const (
+	// maxEvents bounds the events kept per stream. A client that missed more
+	// than that cannot resume the stream.
+	maxEvents = 256
+	// maxStreams bounds the streams kept across all sessions. Beyond it the
+	// least recently used closed streams are dropped early.
+	maxStreams = 1024
+)
+
+// HeaderLastEventID is the header a resuming client sends with the ID of the
+// last event it received
+const HeaderLastEventID = "Last-Event-ID"
+
+// Store keeps the events sent on the SSE streams of the streamable HTTP
+// transport, keyed by session and event ID
+type Store struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+// NewStore returns a store that keeps the events of a stream for the given
+// retention after the stream was last used
+func NewStore(retention time.Duration) *Store {
+	return &Store{
+		retention: retention,
+		now:       time.Now,
+		streams:   map[string]*stream{},
+	}
+}
+
+// event is an SSE event as written by mcp-go, without its ID line
+type event struct {
+	seq  uint64
+	data []byte
+}
+
+// stream is a single SSE response: the stream a POST request was upgraded to,
+// or a GET listening stream. Event IDs are "<stream ID>-<sequence number>".
+type stream struct {
+	id      string
+	session string
+	// listening is set for GET streams, which carry server-initiated messages
+	// for as long as the client listens, while the stream of a POST request
+	// ends with the response
+	listening bool
+	// done is closed when the POST request that opened the stream returns
+	done chan struct{}
+
+	mu      sync.Mutex
+	events  []event
+	lastSeq uint64
+	// owner is the connection events are delivered to, nil while the client
+	// is disconnected
+	owner *conn
+	// active counts the requests writing to or waiting on the stream
+	active  int
+	updated time.Time
+}
+
+// open registers a new stream of the session that delivers its events to c
+func (s *Store) open(session string, listening bool, c *conn) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+	st := &stream{
+		id:        newStreamID(),
+		session:   session,
+		listening: listening,
+		done:      make(chan struct{}),
+		owner:     c,
+		active:    1,
+		updated:   now,
+	}
+	s.streams[st.id] = st
+	return st
+}
+
+// lookup returns the stream of the session the event belongs to together
+// with the sequence number of the event
+func (s *Store) lookup(session, eventID string) (*stream, uint64, bool) {
+	id, seqText, ok := strings.Cut(eventID, "-")
+	if !ok {
+		return nil, 0, false
+	}
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune(s.now())
+	st, ok := s.streams[id]
+	if !ok || st.session != session {
+		return nil, 0, false
+	}
+	return st, seq, true
+}
+
+// dropSession forgets the streams of a terminated session
+func (s *Store) dropSession(session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, st := range s.streams {
+		if st.session == session {
+			delete(s.streams, id)
+		}
+	}
+}
+
+// prune drops the streams that are no longer in use and expired, and the
+// least recently used ones when there are too many. Must be called with s.mu
+// held.
+func (s *Store) prune(now time.Time) {
+	type idleStream struct {
+		id      string
+		updated time.Time
+	}
+	var idle []idleStream
+	for id, st := range s.streams {
+		st.mu.Lock()
+		active, updated := st.active, st.updated
+		st.mu.Unlock()
+		if active > 0 {
+			continue
+		}
+		if now.Sub(updated) > s.retention {
+			delete(s.streams, id)
+			continue
+		}
+		idle = append(idle, idleStream{id, updated})
+	}
+
+	for len(s.streams) >= maxStreams && len(idle) > 0 {
+		oldest := 0
+		for i, candidate := range idle {
+			if candidate.updated.Before(idle[oldest].updated) {
+				oldest = i
+			}
+		}
+		delete(s.streams, idle[oldest].id)
+		idle = append(idle[:oldest], idle[oldest+1:]...)
+	}
+}
+
+// record stores an event and delivers it to the connected client, if any
+func (st *stream) record(data []byte, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.lastSeq++
+	ev := event{seq: st.lastSeq, data: append([]byte(nil), data...)}
+	st.events = append(st.events, ev)
+	if len(st.events) > maxEvents {
+		st.events = st.events[len(st.events)-maxEvents:]
+	}
+	st.updated = now
+
+	if st.owner != nil && !st.owner.send(st.id, ev) {
+		st.owner = nil
+	}
+}
+
+// attach replays the events following the given one to c and delivers the
+// events of the stream to it from then on. It fails when some of the events
+// to replay have been dropped already.
+func (st *stream) attach(c *conn, after uint64) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if after > st.lastSeq || (len(st.events) > 0 && after+1 < st.events[0].seq) {
+		return false
+	}
+	c.start()
+	for _, ev := range st.events {
+		if ev.seq > after && !c.send(st.id, ev) {
+			break
+		}
+	}
+	c.flush()
+	st.owner = c
+	st.active++
+	return true
+}
+
+// detach stops delivering events to c once its request returns
+func (st *stream) detach(c *conn, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.owner == c {
+		st.owner = nil
+	}
+	st.active--
+	st.updated = now
+}
+
+// flush flushes the events delivered to the connected client
+func (st *stream) flush() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.owner != nil {
+		st.owner.flush()
+	}
+}
+
+// newStreamID returns a random stream ID
+func newStreamID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// MethodNotificationCancelled is sent by clients that no longer need the
+// result of a request
+const MethodNotificationCancelled = "notifications/cancelled"
+
+// requestIDMetaKey passes the JSON-RPC request ID of a tool call from the
+// BeforeCallTool hook, which is given the ID, to the tool handler middleware,
+// which is not
+const requestIDMetaKey = "tempo-mcp-server/requestId"
+
+// inflightCall is a running tool call that can be cancelled by the client
+type inflightCall struct {
+	cancel context.CancelFunc
+}
+
+var (
+	inflightMu sync.Mutex
+	inflight   = map[string]*inflightCall{}
+)
+
+// WithCancellation makes tool calls abort when the client sends
+// notifications/cancelled for them. mcp-go leaves cancelled requests running,
+// so each call runs with its own context, registered under the session and
+// request ID, that the notification cancels. In-flight Tempo requests are
+// aborted with it.
+//
+// The request ID is only available to hooks, so the option adds a hook to the
+// given hooks, which must be the ones passed to server.WithHooks: that option
+// replaces the server's hooks rather than adding to them.
+func WithCancellation(hooks *server.Hooks) server.ServerOption {
+	hooks.AddBeforeCallTool(func(ctx context.Context, id any, message *mcp.CallToolRequest) {
+		if message.Params.Meta == nil {
+			message.Params.Meta = &mcp.Meta{}
+		}
+		if message.Params.Meta.AdditionalFields == nil {
+			message.Params.Meta.AdditionalFields = map[string]any{}
+		}
+		message.Params.Meta.AdditionalFields[requestIDMetaKey] = id
+	})
+	return func(s *server.MCPServer) {
+		server.WithToolHandlerMiddleware(cancellableToolHandler)(s)
+		s.AddNotificationHandler(MethodNotificationCancelled, handleCancelledNotification)
+	}
+}
+
+// cancellableToolHandler runs the tool call with a context that
+// handleCancelledNotification can cancel
+func cancellableToolHandler(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if request.Params.Meta == nil {
+			return next(ctx, request)
+		}
+		id, ok := request.Params.Meta.AdditionalFields[requestIDMetaKey]
+		key, hasSession := inflightKey(ctx, id)
+		if !ok || !hasSession {
+			return next(ctx, request)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		call := &inflightCall{cancel: cancel}
+		inflightMu.Lock()
+		inflight[key] = call
+		inflightMu.Unlock()
+		defer func() {
+			inflightMu.Lock()
+			if inflight[key] == call {
+				delete(inflight, key)
+			}
+			inflightMu.Unlock()
+		}()
+
+		return next(ctx, request)
+	}
+}
+
+// handleCancelledNotification cancels the tool call named by the notification
+func handleCancelledNotification(ctx context.Context, notification mcp.JSONRPCNotification) {
+	id, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	key, hasSession := inflightKey(ctx, id)
+	if !hasSession {
+		return
+	}
+
+	inflightMu.Lock()
+	call := inflight[key]
+	inflightMu.Unlock()
+	if call == nil {
+		// The call finished before the notification arrived
+		return
+	}
+
+	reason, _ := notification.Params.AdditionalFields["reason"].(string)
+	logger.Printf("Cancelling request %v at the client's request: %s", id, reason)
+	call.cancel()
+}
+
+// inflightKey identifies a request within its session. Calls without a
+// session, e.g. over stateless HTTP, cannot be told apart between clients and
+// are not registered.
+func inflightKey(ctx context.Context, id any) (string, bool) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil || session.SessionID() == "" {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%v", session.SessionID(), id), true
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// testSession is an initialized client session collecting the notifications
+// sent to it
+type testSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func newTestSession(id string) *testSession {
+	return &testSession{id: id, notifications: make(chan mcp.JSONRPCNotification, 16)}
+}
+
+func (s *testSession) Initialize()                                         {}
+func (s *testSession) Initialized() bool                                   { return true }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *testSession) SessionID() string                                   { return s.id }
+
+// newCancellableServer returns a server with cancellation enabled offering
+// the tool "call" handled by handler
+func newCancellableServer(handler server.ToolHandlerFunc) *server.MCPServer {
+	hooks := &server.Hooks{}
+	s := server.NewMCPServer("test", "1.0.0", server.WithHooks(hooks), WithCancellation(hooks))
+	s.AddTool(mcp.NewTool("call"), handler)
+	return s
+}
+
+// blockingCall is a tool call that blocks until its context is cancelled
+type blockingCall struct {
+	started   chan struct{}
+	cancelled atomic.Bool
+}
+
+func newBlockingCall() *blockingCall {
+	return &blockingCall{started: make(chan struct{})}
+}
+
+func (c *blockingCall) handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	close(c.started)
+	<-ctx.Done()
+	c.cancelled.Store(true)
+	return nil, ctx.Err()
+}
+
+// callTool sends a tools/call request with the given ID in the session and
+// returns the channel receiving the response
+func callTool(s *server.MCPServer, session server.ClientSession, id int) <-chan mcp.JSONRPCMessage {
+	response := make(chan mcp.JSONRPCMessage, 1)
+	message := fmt.Sprintf(`{"jsonrpc": "2.0", "id": %d, "method": "tools/call", "params": {"name": "call"}}`, id)
+	go func() {
+		response <- s.HandleMessage(s.WithContext(context.Background(), session), json.RawMessage(message))
+	}()
+	return response
+}
+
+// cancelRequest sends notifications/cancelled for the request ID in the session
+func cancelRequest(s *server.MCPServer, session server.ClientSession, id int) {
+	message := fmt.Sprintf(`{"jsonrpc": "2.0", "method": %q, "params": {"requestId": %d, "reason": "test"}}`, MethodNotificationCancelled, id)
+	s.HandleMessage(s.WithContext(context.Background(), session), json.RawMessage(message))
+}
+
+func waitStarted(t *testing.T, call *blockingCall) {
+	t.Helper()
+	select {
+	case <-call.started:
+	case <-time.After(time.Second):
+		t.Fatal("tool call did not start")
+	}
+}
+
+func TestCancelInFlightCall(t *testing.T) {
+	call := newBlockingCall()
+	s := newCancellableServer(call.handle)
+	session := newTestSession("session")
+
+	response := callTool(s, session, 7)
+	waitStarted(t, call)
+	cancelRequest(s, session, 7)
+
+	select {
+	case message := <-response:
+		if _, ok := message.(mcp.JSONRPCError); !ok {
+			t.Errorf("cancelled call returned %#v, want an error", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled call is still running")
+	}
+	if !call.cancelled.Load() {
+		t.Error("context of the call was not cancelled")
+	}
+
+	inflightMu.Lock()
+	defer inflightMu.Unlock()
+	if len(inflight) != 0 {
+		t.Errorf("%d calls are still registered after the call returned", len(inflight))
+	}
+}
+
+func TestCancelUnknownRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		session string
+		id      int
+	}{
+		{"unknown request ID", "session", 8},
+		{"request of another session", "other", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			call := newBlockingCall()
+			s := newCancellableServer(call.handle)
+			session := newTestSession("session")
+
+			response := callTool(s, session, 7)
+			waitStarted(t, call)
+			cancelRequest(s, newTestSession(tt.session), tt.id)
+
+			select {
+			case message := <-response:
+				t.Fatalf("call returned %#v after cancelling a different request", message)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			cancelRequest(s, session, 7)
+			select {
+			case <-response:
+			case <-time.After(time.Second):
+				t.Fatal("call was not cancelled")
+			}
+		})
+	}
+}
+
+func TestCancelFinishedRequest(t *testing.T) {
+	s := newCancellableServer(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("done"), nil
+	})
+	session := newTestSession("session")
+
+	message := <-callTool(s, session, 7)
+	if _, ok := message.(mcp.JSONRPCResponse); !ok {
+		t.Fatalf("call returned %#v, want a result", message)
+	}
+	// Cancelling a call that has already returned is a no-op
+	cancelRequest(s, session, 7)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// NewTempoCriticalPathTool creates and returns a tool for analyzing where the time of a trace went
+func NewTempoCriticalPathTool() mcp.Tool {
+	return mcp.NewTool("tempo_critical_path",
+		append(
+			common.ConnectionParams(),
+			mcp.WithDescription("Compute the critical path of a trace in Grafana Tempo: the chain of spans that determined its latency, "+
+				"with each span's self-time and contribution to the total duration. Use it to answer where the time of a request went."),
+			mcp.WithString("trace_id",
+				mcp.Required(),
+				mcp.Description("Tempo trace ID"),
+			),
+		)...,
+	)
+}
+
+// HandleTempoCriticalPath handles critical path tool requests
+func HandleTempoCriticalPath(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	traceID, ok := request.GetArguments()["trace_id"].(string)
+	if !ok || traceID == "" {
+		return nil, fmt.Errorf("trace_id is required")
+	}
+	logger.Printf("Received Tempo critical path request: %s", traceID)
+
+	body, parsed, err := fetchTempoTrace(ctx, request, traceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+	}
+
+	trace, err := parseFetchedTrace(body, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	path := otlp.ComputeCriticalPath(otlp.BuildTree(trace))
+	logger.Printf("Critical path of trace %s has %d spans", traceID, len(path.Spans))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: formatCriticalPath(traceID, path),
+			},
+		},
+	}, nil
+}
+
+// formatCriticalPath formats the critical path as the chain of spans in tree
+// order followed by the largest contributors
+func formatCriticalPath(traceID string, path *otlp.CriticalPath) string {
+	if path.Root == nil {
+		return fmt.Sprintf("Trace %s contains no spans", traceID)
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Critical path of trace %s (%s, %d spans on the path):\n",
+		traceID, formatSpanDuration(path.Total), len(path.Spans)))
+	output.WriteString(fmt.Sprintf("Root: %s [%s]\n\n", path.Root.Span.Name, path.Root.Span.ServiceName()))
+
+	output.WriteString("Path (contribution, share of total, self-time, span):\n")
+	for _, s := range path.Spans {
+		output.WriteString(fmt.Sprintf("  %8s %5.1f%%  self %-8s %s%s [%s]%s\n",
+			formatSpanDuration(s.Contribution),
+			percentOf(s.Contribution, path.Total),
+			formatSpanDuration(s.SelfTime),
+			strings.Repeat("  ", s.Depth),
+			s.Span.Name,
+			s.Span.ServiceName(),
+			errorSuffix(s.Span)))
+	}
+
+	top := append([]otlp.CriticalPathSpan(nil), path.Spans...)
+	sort.SliceStable(top, func(i, j int) bool { return top[i].Contribution > top[j].Contribution })
+	if len(top) > 5 {
+		top = top[:5]
+	}
+
+	output.WriteString("\nLargest contributors:\n")
+	for i, s := range top {
+		output.WriteString(fmt.Sprintf("  %d. %s [%s]: %s (%.1f%% of total)\n",
+			i+1, s.Span.Name, s.Span.ServiceName(), formatSpanDuration(s.Contribution), percentOf(s.Contribution, path.Total)))
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// errorSuffix marks spans with an error status
+func errorSuffix(span *otlp.Span) string {
+	if span.IsError() {
+		return " ERROR"
+	}
+	return ""
+}
+
+// percentOf returns part as a percentage of total
+func percentOf(part, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+)
+
+// Query types supported by the metrics tool
+const (
+	MetricsQueryRange   = "range"
+	MetricsQueryInstant = "instant"
+)
+
+// maxFormattedSeries bounds the number of series included in the text summary
+const maxFormattedSeries = 50
+
+// TempoMetricsResponse represents the response of Tempo's /api/metrics/query_range
+// and /api/metrics/query endpoints
+type TempoMetricsResponse struct {
+	Series []TempoMetricsSeries `json:"series"`
+}
+
+// TempoMetricsSeries is a single time series returned by a TraceQL metrics query.
+// Range queries populate Samples, instant queries populate Value.
+type TempoMetricsSeries struct {
+	Labels     []TempoMetricsLabel `json:"labels"`
+	PromLabels string              `json:"promLabels,omitempty"`
+	Samples    []TempoSample       `json:"samples,omitempty"`
+	Value      *float64            `json:"value,omitempty"`
+}
+
+// TempoMetricsLabel is a series label whose value is encoded as an OTLP AnyValue
+type TempoMetricsLabel struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// TempoSample is a single data point of a range query series
+type TempoSample struct {
+	TimestampMs jsonInt64 `json:"timestampMs"`
+	Value       float64   `json:"value"`
+}
+
+// MetricsResult is the structured content returned by the metrics tool
+type MetricsResult struct {
+	Query  string          `json:"query"`
+	Type   string          `json:"type"`
+	Start  time.Time       `json:"start"`
+	End    time.Time       `json:"end"`
+	Step   string          `json:"step,omitempty"`
+	Series []MetricsSeries `json:"series"`
+}
+
+// MetricsSeries is a single series of the structured metrics result
+type MetricsSeries struct {
+	Labels  map[string]string `json:"labels"`
+	Samples []MetricsSample   `json:"samples,omitempty"`
+	Value   *float64          `json:"value,omitempty"`
+}
+
+// MetricsSample is a single data point of the structured metrics result
+type MetricsSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// jsonInt64 decodes 64-bit integers that Tempo encodes either as JSON numbers
+// or, following the protobuf JSON mapping, as strings
+type jsonInt64 int64
+
+func (i *jsonInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = jsonInt64(n)
+	return nil
+}
+
+// NewTempoMetricsTool creates and returns a tool for running TraceQL metrics queries
+func NewTempoMetricsTool() mcp.Tool {
+	return mcp.NewTool("tempo_metrics",
+		append(
+			common.ConnectionParams(),
+			mcp.WithDescription("Run a TraceQL metrics query against Grafana Tempo, e.g. {} | rate() by (resource.service.name) "+
+				"or {} | quantile_over_time(duration, .99) by (span.http.route)"),
+			mcp.WithString("query",
+				mcp.Required(),
+				mcp.Description("TraceQL metrics query"),
+			),
+			mcp.WithString("type",
+				mcp.Description("Query type: range returns a time series per group, instant a single value per group (default: range)"),
+				mcp.Enum(MetricsQueryRange, MetricsQueryInstant),
+			),
+			mcp.WithString("start",
+				mcp.Description("Start time for the query (default: 1h ago)"),
+			),
+			mcp.WithString("end",
+				mcp.Description("End time for the query (default: now)"),
+			),
+			mcp.WithString("step",
+				mcp.Description("Resolution of range queries, e.g. 30s or 5m (default: chosen by Tempo)"),
+			),
+		)...,
+	)
+}
+
+// HandleTempoMetrics handles TraceQL metrics tool requests
+func HandleTempoMetrics(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	queryString, ok := request.GetArguments()["query"].(string)
+	if !ok || queryString == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	logger.Printf("Received Tempo metrics request: %s", queryString)
+
+	queryType := MetricsQueryRange
+	if typeArg, ok := request.GetArguments()["type"].(string); ok && typeArg != "" {
+		if typeArg != MetricsQueryRange && typeArg != MetricsQueryInstant {
+			return nil, fmt.Errorf("invalid type %q (expected %s or %s)", typeArg, MetricsQueryRange, MetricsQueryInstant)
+		}
+		queryType = typeArg
+	}
+
+	// Set defaults for optional parameters
+	start := time.Now().Add(-1 * time.Hour)
+	end := time.Now()
+
+	if startTime, ok, err := parseTimeArg(request, "start"); err != nil {
+		return nil, err
+	} else if ok {
+		start = startTime
+	}
+
+	if endTime, ok, err := parseTimeArg(request, "end"); err != nil {
+		return nil, err
+	} else if ok {
+		end = endTime
+	}
+
+	step, _ := request.GetArguments()["step"].(string)
+	if step != "" {
+		if _, err := time.ParseDuration(step); err != nil {
+			return nil, fmt.Errorf("invalid step: %v", err)
+		}
+	}
+
+	params := url.Values{}
+	params.Set("q", queryString)
+	params.Set("start", fmt.Sprintf("%d", start.Unix()))
+	params.Set("end", fmt.Sprintf("%d", end.Unix()))
+
+	apiPath := "/api/metrics/query"
+	if queryType == MetricsQueryRange {
+		apiPath = "/api/metrics/query_range"
+		if step != "" {
+			params.Set("step", step)
+		}
+	}
+
+	body, err := common.MakeTempoRequest(ctx, logger, request, func(tempoURL string) (string, error) {
+		return buildTempoAPIURL(tempoURL, apiPath, params)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+	}
+
+	var response TempoMetricsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics response: %v", err)
+	}
+
+	result := &MetricsResult{
+		Query:  queryString,
+		Type:   queryType,
+		Start:  start.Truncate(time.Second).UTC(),
+		End:    end.Truncate(time.Second).UTC(),
+		Step:   step,
+		Series: convertMetricsSeries(response.Series),
+	}
+
+	logger.Printf("Metrics query returned %d series", len(result.Series))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: formatMetricsResult(result),
+			},
+		},
+		StructuredContent: result,
+	}, nil
+}
+
+// convertMetricsSeries converts Tempo's series into the structured result form
+func convertMetricsSeries(series []TempoMetricsSeries) []MetricsSeries {
+	converted := make([]MetricsSeries, 0, len(series))
+	for _, s := range series {
+		labels := make(map[string]string, len(s.Labels))
+		for _, label := range s.Labels {
+			labels[label.Key] = formatAnyValue(label.Value)
+		}
+
+		out := MetricsSeries{Labels: labels, Value: s.Value}
+		for _, sample := range s.Samples {
+			out.Samples = append(out.Samples, MetricsSample{
+				Timestamp: time.UnixMilli(int64(sample.TimestampMs)).UTC(),
+				Value:     sample.Value,
+			})
+		}
+		sort.Slice(out.Samples, func(i, j int) bool {
+			return out.Samples[i].Timestamp.Before(out.Samples[j].Timestamp)
+		})
+		converted = append(converted, out)
+	}
+	return converted
+}
+
+// formatAnyValue renders an OTLP AnyValue such as {"stringValue":"x"} as a plain string
+func formatAnyValue(value map[string]interface{}) string {
+	for _, v := range value {
+		switch typed := v.(type) {
+		case string:
+			return typed
+		case float64:
+			return strconv.FormatFloat(typed, 'f', -1, 64)
+		default:
+			return fmt.Sprintf("%v", typed)
+		}
+	}
+	return ""
+}
+
+// formatMetricsResult formats the metrics result into a readable summary
+func formatMetricsResult(result *MetricsResult) string {
+	if len(result.Series) == 0 {
+		return "No series returned by the metrics query"
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d series for %s query %s (%s to %s):\n\n",
+		len(result.Series), result.Type, result.Query,
+		result.Start.Format(time.RFC3339), result.End.Format(time.RFC3339)))
+
+	for i, series := range result.Series {
+		if i >= maxFormattedSeries {
+			output.WriteString(fmt.Sprintf("... %d more series not shown\n", len(result.Series)-maxFormattedSeries))
+			break
+		}
+
+		output.WriteString(fmt.Sprintf("Series %d: %s\n", i+1, formatSeriesLabels(series.Labels)))
+
+		if series.Value != nil {
+			output.WriteString(fmt.Sprintf("  Value: %s\n", formatFloat(*series.Value)))
+		}
+
+		if len(series.Samples) > 0 {
+			minVal, maxVal, sum := series.Samples[0].Value, series.Samples[0].Value, 0.0
+			for _, sample := range series.Samples {
+				minVal = math.Min(minVal, sample.Value)
+				maxVal = math.Max(maxVal, sample.Value)
+				sum += sample.Value
+			}
+			last := series.Samples[len(series.Samples)-1]
+			output.WriteString(fmt.Sprintf("  Samples: %d\n", len(series.Samples)))
+			output.WriteString(fmt.Sprintf("  Min: %s, Max: %s, Avg: %s\n",
+				formatFloat(minVal), formatFloat(maxVal), formatFloat(sum/float64(len(series.Samples)))))
+			output.WriteString(fmt.Sprintf("  Last: %s at %s\n", formatFloat(last.Value), last.Timestamp.Format(time.RFC3339)))
+		}
+
+		output.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// formatSeriesLabels renders series labels in Prometheus style, e.g. {a="b", c="d"}
+func formatSeriesLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// formatFloat renders a float without trailing zeros
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+)
+
+// queryHintsPattern matches the hints clause at the end of a TraceQL query,
+// e.g. with (sample=true)
+var queryHintsPattern = regexp.MustCompile(`with\s*\(([^)]*)\)\s*$`)
+
+// searchCursor is the continuation state of a paged search. Pages move
+// backwards in time: the next page searches up to the start of the oldest
+// trace returned so far. This relies on Tempo returning the most recent
+// matches, which it only does for TraceQL queries with the most_recent hint
+// (see withMostRecentHint), so the hint is sent on every request of a paged
+// search, and only then. Because Tempo's time window has a granularity of
+// seconds, traces starting in that last second were possibly returned
+// already and are excluded by ID.
+type searchCursor struct {
+	searchOptions
+	cursorScope
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// cursorScope identifies the datasource a paged search runs against, so that
+// a cursor is not continued against another datasource or tenant, where it
+// would silently return a wrong continuation
+type cursorScope struct {
+	Datasource string `json:"ds"`
+	Tenant     string `json:"tenant,omitempty"`
+	URL        string `json:"url"`
+}
+
+// newCursorScope returns the scope of searches against the datasource. The
+// URL is stored without credentials.
+func newCursorScope(ds common.Datasource) (cursorScope, error) {
+	tenant, err := common.ParseTenant(ds.Tenant)
+	if err != nil {
+		return cursorScope{}, err
+	}
+	scope := cursorScope{Datasource: ds.Name, Tenant: tenant, URL: ds.URL}
+	if u, err := url.Parse(ds.URL); err == nil {
+		scope.URL = u.Redacted()
+	}
+	return scope, nil
+}
+
+// checkScope verifies that the cursor was created by a search against the
+// same datasource, tenant and URL
+func (c searchCursor) checkScope(scope cursorScope) error {
+	if c.cursorScope != scope {
+		return fmt.Errorf("cursor was created for datasource %q (tenant %q, url %s), not for datasource %q (tenant %q, url %s); "+
+			"pass the same datasource, tenant and url arguments as the call that returned it",
+			c.Datasource, c.Tenant, c.URL, scope.Datasource, scope.Tenant, scope.URL)
+	}
+	return nil
+}
+
+// encodeCursor serializes the cursor into an opaque token for the tool result
+func encodeCursor(cursor searchCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a token created by encodeCursor
+func decodeCursor(token string) (searchCursor, error) {
+	var cursor searchCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %v", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("invalid cursor: %v", err)
+	}
+	if (cursor.Query == "" && cursor.Tags == "") || cursor.Limit < 1 || cursor.End <= cursor.Start {
+		return cursor, fmt.Errorf("invalid cursor")
+	}
+	return cursor, nil
+}
+
+// pageTraces drops the excluded traces from a search result and returns the
+// most recent limit traces, newest first
+func pageTraces(traces []TempoTrace, exclude []string, limit int) []TempoTrace {
+	page := make([]TempoTrace, 0, len(traces))
+	for _, trace := range traces {
+		if !slices.Contains(exclude, trace.TraceID) {
+			page = append(page, trace)
+		}
+	}
+	sort.SliceStable(page, func(i, j int) bool {
+		return traceStartNanos(page[i]) > traceStartNanos(page[j])
+	})
+	if len(page) > limit {
+		page = page[:limit]
+	}
+	return page
+}
+
+// nextSearchCursor returns the cursor of the page following the given one,
+// or false when the window has been searched completely
+func nextSearchCursor(cursor searchCursor, page []TempoTrace) (searchCursor, bool) {
+	if len(page) == 0 {
+		return searchCursor{}, false
+	}
+	oldest := traceStartNanos(page[len(page)-1]) / 1e9
+
+	next := searchCursor{searchOptions: cursor.searchOptions, cursorScope: cursor.cursorScope}
+	next.End = oldest + 1
+	if next.End <= next.Start {
+		return searchCursor{}, false
+	}
+
+	// Keep excluding the traces of the boundary second returned on earlier
+	// pages when the window did not move
+	if next.End == cursor.End {
+		next.Exclude = append(next.Exclude, cursor.Exclude...)
+	}
+	for _, trace := range page {
+		if traceStartNanos(trace)/1e9 == oldest {
+			next.Exclude = append(next.Exclude, trace.TraceID)
+		}
+	}
+	return next, true
+}
+
+// traceStartNanos returns the start of a search result trace in Unix nanoseconds
+func traceStartNanos(trace TempoTrace) int64 {
+	if start, ok := parseUnixNano(trace.StartTimeUnixNano); ok {
+		return start.UnixNano()
+	}
+	return 0
+}
+
+// withMostRecentHint adds the most_recent=true hint to a TraceQL query, so
+// that a search stopped at its limit returns the most recent matches rather
+// than the first ones Tempo happened to find. Without it traces newer than
+// the oldest one returned could be skipped when paging.
+func withMostRecentHint(query string) string {
+	if query == "" || strings.Contains(query, "most_recent") {
+		return query
+	}
+	if m := queryHintsPattern.FindStringSubmatchIndex(query); m != nil {
+		if strings.TrimSpace(query[m[2]:m[3]]) == "" {
+			return query[:m[2]] + "most_recent=true" + query[m[3]:]
+		}
+		return query[:m[2]] + "most_recent=true, " + query[m[2]:]
+	}
+	return query + " with (most_recent=true)"
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+)
+
+// progressInterval is the minimum time between notifications about the
+// bytes received from Tempo
+const progressInterval = 250 * time.Millisecond
+
+// progressReporter sends notifications/progress messages for a tool call.
+// Notifications are only sent when the client asked for them by passing a
+// progress token with the request; otherwise reporting is a no-op.
+type progressReporter struct {
+	ctx    context.Context
+	server *server.MCPServer
+	token  mcp.ProgressToken
+
+	mu       sync.Mutex
+	progress float64
+	finished bool
+}
+
+// newProgressReporter returns the progress reporter of a tool call
+func newProgressReporter(ctx context.Context, request mcp.CallToolRequest) *progressReporter {
+	p := &progressReporter{ctx: ctx, server: server.ServerFromContext(ctx)}
+	if request.Params.Meta != nil {
+		p.token = request.Params.Meta.ProgressToken
+	}
+	return p
+}
+
+// report sends a progress notification. Progress must increase with every
+// notification; total may be zero when it is unknown.
+func (p *progressReporter) report(progress, total float64, message string) {
+	if !p.enabled() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.finished || progress <= p.progress {
+		return
+	}
+	p.progress = progress
+
+	params := map[string]any{
+		"progressToken": p.token,
+		"progress":      progress,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if message != "" {
+		params["message"] = message
+	}
+	if err := p.server.SendNotificationToClient(p.ctx, "notifications/progress", params); err != nil {
+		logger.Printf("Failed to send progress notification: %v", err)
+	}
+}
+
+// step reports progress one step after the previous notification
+func (p *progressReporter) step(message string) {
+	p.mu.Lock()
+	next := p.progress + 1
+	p.mu.Unlock()
+	p.report(next, 0, message)
+}
+
+// finish stops reporting when the tool call completes. Callbacks of Tempo
+// requests may still run afterwards, e.g. the transport reporting a request as
+// written once the response has already been handled, and the client must not
+// be notified about a call it has received the result of.
+func (p *progressReporter) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished = true
+}
+
+// enabled reports whether the client asked for progress notifications
+func (p *progressReporter) enabled() bool {
+	return p.token != nil && p.server != nil
+}
+
+// trackRequest returns a context that reports the progress of Tempo requests
+// made with it: when a request has been sent, and how much of the response
+// has been received at most every progressInterval
+func (p *progressReporter) trackRequest(ctx context.Context) context.Context {
+	if !p.enabled() {
+		return ctx
+	}
+
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				p.step("Request sent to Tempo, waiting for the response")
+			}
+		},
+	})
+
+	var last time.Time
+	return common.WithReadProgress(ctx, func(received, total int64) {
+		if received != total && time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		if total > 0 {
+			p.step(fmt.Sprintf("Received %s of %s from Tempo", formatBytes(received), formatBytes(total)))
+		} else {
+			p.step(fmt.Sprintf("Received %s from Tempo", formatBytes(received)))
+		}
+	})
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestProgressStopsAfterCallCompletes(t *testing.T) {
+	var reporter *progressReporter
+	s := newCancellableServer(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		reporter = newProgressReporter(ctx, request)
+		defer reporter.finish()
+		reporter.step("Request sent to Tempo, waiting for the response")
+		reporter.step("Received 1 KiB from Tempo")
+		return mcp.NewToolResultText("done"), nil
+	})
+	session := newTestSession("session")
+
+	message := `{"jsonrpc": "2.0", "id": 1, "method": "tools/call", "params": {"name": "call", "_meta": {"progressToken": "token"}}}`
+	if _, ok := s.HandleMessage(s.WithContext(context.Background(), session), json.RawMessage(message)).(mcp.JSONRPCResponse); !ok {
+		t.Fatal("tool call failed")
+	}
+	if n := len(session.notifications); n != 2 {
+		t.Fatalf("call sent %d progress notifications, want 2", n)
+	}
+	for want := 1.0; want <= 2; want++ {
+		notification := <-session.notifications
+		if notification.Method != "notifications/progress" || notification.Params.AdditionalFields["progress"] != want {
+			t.Errorf("notification = %s %v, want progress %v", notification.Method, notification.Params.AdditionalFields, want)
+		}
+	}
+
+	// Callbacks of requests outliving the call, e.g. of the transport, must
+	// not notify the client anymore
+	reporter.step("Received 2 KiB from Tempo")
+	reporter.report(10, 10, "")
+	if n := len(session.notifications); n != 0 {
+		t.Errorf("%d progress notifications were sent after the call completed", n)
+	}
+}
+
+func TestProgressDisabledWithoutToken(t *testing.T) {
+	s := newCancellableServer(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		reporter := newProgressReporter(ctx, request)
+		defer reporter.finish()
+		if reporter.enabled() {
+			t.Error("reporter is enabled although the client passed no progress token")
+		}
+		reporter.step("Request sent to Tempo, waiting for the response")
+		return mcp.NewToolResultText("done"), nil
+	})
+	session := newTestSession("session")
+
+	<-callTool(s, session, 1)
+	if n := len(session.notifications); n != 0 {
+		t.Errorf("%d progress notifications were sent without a progress token", n)
+	}
+}
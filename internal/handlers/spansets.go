@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// maxFormattedSpans bounds the number of spans listed per spanset in the text summary
+const maxFormattedSpans = 10
+
+// TempoSpanSet is a group of spans of a trace that matched a TraceQL
+// spanset filter. Matched counts all matching spans, of which at most spss
+// are returned. Attributes holds the values of by() groupings and aggregates.
+type TempoSpanSet struct {
+	Spans      []TempoSpan     `json:"spans"`
+	Matched    int             `json:"matched"`
+	Attributes []otlp.KeyValue `json:"attributes,omitempty"`
+}
+
+// TempoSpan is a matching span of a spanset, including the attributes
+// selected with | select(...)
+type TempoSpan struct {
+	SpanID            string          `json:"spanID"`
+	Name              string          `json:"name,omitempty"`
+	StartTimeUnixNano jsonInt64       `json:"startTimeUnixNano"`
+	DurationNanos     jsonInt64       `json:"durationNanos"`
+	Attributes        []otlp.KeyValue `json:"attributes,omitempty"`
+}
+
+// QuerySpanSet is a spanset of the structured query result
+type QuerySpanSet struct {
+	Matched    int                    `json:"matched"`
+	Spans      []QuerySpan            `json:"spans"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// QuerySpan is a matching span of the structured query result
+type QuerySpan struct {
+	SpanID     string                 `json:"spanID"`
+	Name       string                 `json:"name,omitempty"`
+	Start      time.Time              `json:"start"`
+	DurationMs float64                `json:"durationMs"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// matchedSpanSets returns all spansets of a search result. Tempo returns
+// them in spanSets and, for compatibility, the first one in spanSet as well;
+// older versions only set spanSet.
+func (t TempoTrace) matchedSpanSets() []TempoSpanSet {
+	if len(t.SpanSets) > 0 {
+		return t.SpanSets
+	}
+	if t.SpanSet != nil {
+		return []TempoSpanSet{*t.SpanSet}
+	}
+	return nil
+}
+
+// convertSpanSets converts Tempo's spansets into the structured result form
+func convertSpanSets(spanSets []TempoSpanSet) []QuerySpanSet {
+	if len(spanSets) == 0 {
+		return nil
+	}
+	converted := make([]QuerySpanSet, 0, len(spanSets))
+	for _, spanSet := range spanSets {
+		out := QuerySpanSet{
+			Matched: spanSet.Matched,
+			Spans:   make([]QuerySpan, 0, len(spanSet.Spans)),
+		}
+		if len(spanSet.Attributes) > 0 {
+			out.Attributes = otlp.AttributeMap(spanSet.Attributes)
+		}
+		for _, span := range spanSet.Spans {
+			querySpan := QuerySpan{
+				SpanID:     span.SpanID,
+				Name:       span.Name,
+				Start:      time.Unix(0, int64(span.StartTimeUnixNano)).UTC(),
+				DurationMs: float64(span.DurationNanos) / float64(time.Millisecond),
+			}
+			if len(span.Attributes) > 0 {
+				querySpan.Attributes = otlp.AttributeMap(span.Attributes)
+			}
+			out.Spans = append(out.Spans, querySpan)
+		}
+		converted = append(converted, out)
+	}
+	return converted
+}
+
+// formatSpanSets renders the matched spans of a trace, one block per spanset
+func formatSpanSets(output *strings.Builder, spanSets []TempoSpanSet) {
+	for i, spanSet := range spanSets {
+		header := "  Matched spans"
+		if len(spanSets) > 1 {
+			header = fmt.Sprintf("  Spanset %d", i+1)
+		}
+		output.WriteString(fmt.Sprintf("%s (%d matched%s):\n", header, spanSet.Matched, formatSpanSetAttributes(spanSet.Attributes)))
+
+		for j, span := range spanSet.Spans {
+			if j >= maxFormattedSpans {
+				output.WriteString(fmt.Sprintf("    ... %d more spans not shown\n", len(spanSet.Spans)-maxFormattedSpans))
+				break
+			}
+			output.WriteString(fmt.Sprintf("    - %s\n", formatMatchedSpan(span)))
+		}
+		if notReturned := spanSet.Matched - len(spanSet.Spans); notReturned > 0 {
+			output.WriteString(fmt.Sprintf("    ... %d more matching spans not returned by Tempo\n", notReturned))
+		}
+	}
+}
+
+// formatMatchedSpan renders a matched span as "name span <id> duration @start attr=value ...".
+// The start time is local and carries its offset, like the start time of the
+// trace it belongs to.
+func formatMatchedSpan(span TempoSpan) string {
+	var parts []string
+	if span.Name != "" {
+		parts = append(parts, span.Name)
+	}
+	parts = append(parts, "span "+span.SpanID, formatSpanDuration(time.Duration(span.DurationNanos)))
+	if span.StartTimeUnixNano > 0 {
+		parts = append(parts, "@"+time.Unix(0, int64(span.StartTimeUnixNano)).Format("15:04:05.000Z07:00"))
+	}
+	if attrs := formatKeyValues(span.Attributes); attrs != "" {
+		parts = append(parts, attrs)
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatSpanSetAttributes renders the grouping attributes of a spanset as a
+// suffix of its header
+func formatSpanSetAttributes(attributes []otlp.KeyValue) string {
+	if attrs := formatKeyValues(attributes); attrs != "" {
+		return ", " + attrs
+	}
+	return ""
+}
+
+// formatKeyValues renders attributes sorted by key as key=value pairs
+func formatKeyValues(attributes []otlp.KeyValue) string {
+	sorted := append([]otlp.KeyValue(nil), attributes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	parts := make([]string, 0, len(sorted))
+	for _, kv := range sorted {
+		parts = append(parts, fmt.Sprintf("%s=%s", kv.Key, kv.Value.String()))
+	}
+	return strings.Join(parts, " ")
+}
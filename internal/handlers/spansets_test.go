@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMatchedSpanUsesTraceTimezone(t *testing.T) {
+	defer func(local *time.Location) { time.Local = local }(time.Local)
+	time.Local = time.FixedZone("test", 2*60*60)
+
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).UnixNano()
+	text, err := formatTempoResults(&TempoResult{Traces: []TempoTrace{{
+		TraceID:           "abc",
+		StartTimeUnixNano: fmt.Sprint(start),
+		SpanSet: &TempoSpanSet{Matched: 1, Spans: []TempoSpan{
+			{SpanID: "0102030405060708", Name: "GET", StartTimeUnixNano: jsonInt64(start + int64(1500*time.Millisecond)), DurationNanos: 1000},
+		}},
+	}}})
+	if err != nil {
+		t.Fatalf("formatTempoResults: %v", err)
+	}
+	for _, want := range []string{"Start Time: 2024-05-01T12:00:00+02:00", "@12:00:01.500+02:00"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result does not contain %q:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+	"github.com/scottlepp/tempo-mcp-server/internal/tempopb"
+)
+
+// maxProgressTraces bounds the number of new traces listed per progress notification
+const maxProgressTraces = 5
+
+// streamTempoSearch runs the search over Tempo's gRPC streaming API. Each
+// partial response is merged into the result and forwarded to the client as
+// a progress notification listing the traces found since the previous one.
+func streamTempoSearch(ctx context.Context, progress *progressReporter, client *common.TempoClient, opts searchOptions) (*TempoResult, error) {
+	searchRequest, err := streamingSearchRequest(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TempoResult{}
+	index := map[string]int{}
+
+	err = client.StreamSearch(ctx, logger, searchRequest, func(resp *tempopb.SearchResponse) error {
+		var added []TempoTrace
+		for _, trace := range resp.Traces {
+			converted := convertStreamedTrace(trace)
+			// Later responses may update traces that were already sent
+			if i, ok := index[converted.TraceID]; ok {
+				result.Traces[i] = converted
+				continue
+			}
+			index[converted.TraceID] = len(result.Traces)
+			result.Traces = append(result.Traces, converted)
+			added = append(added, converted)
+		}
+
+		if resp.Metrics != nil {
+			result.Metrics = convertStreamedMetrics(resp.Metrics)
+		}
+		progress.step(formatStreamProgress(result, added))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("Streaming search returned %d traces", len(result.Traces))
+	return result, nil
+}
+
+// streamingSearchRequest converts the search options into the gRPC request
+func streamingSearchRequest(opts searchOptions) (*tempopb.SearchRequest, error) {
+	req := &tempopb.SearchRequest{Query: opts.Query}
+
+	var err error
+	if req.Limit, err = toUint32("limit", int64(opts.Limit)); err != nil {
+		return nil, err
+	}
+	if req.Start, err = toUint32("start", opts.Start); err != nil {
+		return nil, err
+	}
+	if req.End, err = toUint32("end", opts.End); err != nil {
+		return nil, err
+	}
+	if req.SpansPerSpanSet, err = toUint32("spss", int64(opts.SpansPerSpanSet)); err != nil {
+		return nil, err
+	}
+
+	if opts.Tags != "" {
+		tags, err := parseLogfmt(opts.Tags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags: %v", err)
+		}
+		req.Tags = tags
+	}
+
+	if req.MinDurationMs, err = durationMs(opts.MinDuration); err != nil {
+		return nil, err
+	}
+	if req.MaxDurationMs, err = durationMs(opts.MaxDuration); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// durationMs converts an optional duration such as 100ms into milliseconds
+func durationMs(value string) (uint32, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return toUint32("duration "+value, duration.Milliseconds())
+}
+
+// toUint32 converts a search parameter into the unsigned 32-bit form of the
+// gRPC request, rejecting values that do not fit instead of wrapping them
+func toUint32(name string, value int64) (uint32, error) {
+	if value < 0 || value > math.MaxUint32 {
+		return 0, fmt.Errorf("%s is out of range: %d", name, value)
+	}
+	return uint32(value), nil
+}
+
+// convertStreamedTrace converts a streamed trace into the search result form
+func convertStreamedTrace(trace *tempopb.TraceSearchMetadata) TempoTrace {
+	converted := TempoTrace{
+		TraceID:           trace.TraceID,
+		RootServiceName:   trace.RootServiceName,
+		RootTraceName:     trace.RootTraceName,
+		StartTimeUnixNano: strconv.FormatUint(trace.StartTimeUnixNano, 10),
+		DurationMs:        int64(trace.DurationMs),
+	}
+	if trace.SpanSet != nil {
+		spanSet := convertStreamedSpanSet(trace.SpanSet)
+		converted.SpanSet = &spanSet
+	}
+	for _, spanSet := range trace.SpanSets {
+		converted.SpanSets = append(converted.SpanSets, convertStreamedSpanSet(spanSet))
+	}
+	return converted
+}
+
+func convertStreamedSpanSet(spanSet *tempopb.SpanSet) TempoSpanSet {
+	converted := TempoSpanSet{
+		Matched:    int(spanSet.Matched),
+		Attributes: spanSet.Attributes,
+	}
+	for _, span := range spanSet.Spans {
+		converted.Spans = append(converted.Spans, TempoSpan{
+			SpanID:            span.SpanID,
+			Name:              span.Name,
+			StartTimeUnixNano: jsonInt64(span.StartTimeUnixNano),
+			DurationNanos:     jsonInt64(span.DurationNanos),
+			Attributes:        span.Attributes,
+		})
+	}
+	return converted
+}
+
+func convertStreamedMetrics(metrics *tempopb.SearchMetrics) *TempoSearchMetrics {
+	return &TempoSearchMetrics{
+		InspectedTraces: jsonInt64(metrics.InspectedTraces),
+		InspectedBytes:  jsonInt64(metrics.InspectedBytes),
+		TotalBlocks:     jsonInt64(metrics.TotalBlocks),
+		CompletedJobs:   jsonInt64(metrics.CompletedJobs),
+		TotalJobs:       jsonInt64(metrics.TotalJobs),
+		TotalBlockBytes: jsonInt64(metrics.TotalBlockBytes),
+	}
+}
+
+// formatStreamProgress summarizes the state of a streaming search and the
+// traces found since the previous progress notification
+func formatStreamProgress(result *TempoResult, added []TempoTrace) string {
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d traces so far", len(result.Traces)))
+	if m := result.Metrics; m != nil && m.TotalJobs > 0 {
+		output.WriteString(fmt.Sprintf(" (%d of %d jobs completed)", m.CompletedJobs, m.TotalJobs))
+	}
+
+	for i, trace := range added {
+		if i >= maxProgressTraces {
+			output.WriteString(fmt.Sprintf("; and %d more", len(added)-maxProgressTraces))
+			break
+		}
+		separator := ", "
+		if i == 0 {
+			separator = "; new: "
+		}
+		output.WriteString(fmt.Sprintf("%s%s %s %s (%d ms)", separator, trace.TraceID, trace.RootServiceName, trace.RootTraceName, trace.DurationMs))
+	}
+	return output.String()
+}
+
+// parseLogfmt parses space-separated key=value pairs as used by Tempo's tag
+// search. Values containing spaces may be double-quoted.
+func parseLogfmt(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for rest := strings.TrimSpace(s); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \"") {
+			return nil, fmt.Errorf("expected key=value at %q", rest)
+		}
+		if strings.HasPrefix(value, `"`) {
+			quoted, err := strconv.QuotedPrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("unterminated quoted value for %s", key)
+			}
+			rest = value[len(quoted):]
+			value, _ = strconv.Unquote(quoted)
+		} else {
+			value, rest, _ = strings.Cut(value, " ")
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		input string
+		want  map[string]string
+	}{
+		{"", map[string]string{}},
+		{"service.name=api", map[string]string{"service.name": "api"}},
+		{"  a=1   b=2 ", map[string]string{"a": "1", "b": "2"}},
+		{`http.url="/users?id=1 and more" status=500`, map[string]string{"http.url": "/users?id=1 and more", "status": "500"}},
+		{`name="quoted \"inner\""`, map[string]string{"name": `quoted "inner"`}},
+		{"empty=", map[string]string{"empty": ""}},
+		{"a=1 a=2", map[string]string{"a": "2"}},
+	}
+	for _, tt := range tests {
+		got, err := parseLogfmt(tt.input)
+		if err != nil {
+			t.Errorf("parseLogfmt(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLogfmt(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogfmtInvalid(t *testing.T) {
+	for _, input := range []string{"novalue", "=value", `a="unterminated`, `"key"=value`} {
+		if tags, err := parseLogfmt(input); err == nil {
+			t.Errorf("parseLogfmt(%q) = %v, want error", input, tags)
+		}
+	}
+}
+
+func TestStreamingSearchRequest(t *testing.T) {
+	req, err := streamingSearchRequest(searchOptions{
+		Query:           "{}",
+		Tags:            "service.name=api",
+		Start:           1000,
+		End:             2000,
+		Limit:           20,
+		SpansPerSpanSet: 3,
+		MinDuration:     "1.5s",
+		MaxDuration:     "1m",
+	})
+	if err != nil {
+		t.Fatalf("streamingSearchRequest: %v", err)
+	}
+	if req.Query != "{}" || req.Start != 1000 || req.End != 2000 || req.Limit != 20 || req.SpansPerSpanSet != 3 ||
+		req.MinDurationMs != 1500 || req.MaxDurationMs != 60000 || req.Tags["service.name"] != "api" {
+		t.Errorf("streamingSearchRequest = %+v", req)
+	}
+}
+
+func TestStreamingSearchRequestOutOfRange(t *testing.T) {
+	tests := []struct {
+		name string
+		opts searchOptions
+	}{
+		{"negative limit", searchOptions{Limit: -1}},
+		{"negative start", searchOptions{Start: -1}},
+		{"end beyond 2106", searchOptions{End: math.MaxUint32 + 1}},
+		{"negative spans per span set", searchOptions{SpansPerSpanSet: -5}},
+		{"negative duration", searchOptions{MinDuration: "-1s"}},
+		{"duration beyond 49 days", searchOptions{MaxDuration: "1200h"}},
+		{"invalid duration", searchOptions{MinDuration: "fast"}},
+		{"invalid tags", searchOptions{Tags: "novalue"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if req, err := streamingSearchRequest(tt.opts); err == nil {
+				t.Errorf("streamingSearchRequest = %+v, want error", req)
+			}
+		})
+	}
+}
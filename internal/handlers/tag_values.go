@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+)
+
+// TempoTagValuesResult represents the response of Tempo's /api/search/tag/<name>/values endpoint
+type TempoTagValuesResult struct {
+	TagValues []string `json:"tagValues"`
+}
+
+// TempoTagValuesV2Result represents the response of Tempo's /api/v2/search/tag/<name>/values endpoint
+type TempoTagValuesV2Result struct {
+	TagValues []TempoTagValue `json:"tagValues"`
+}
+
+// TempoTagValue is a single attribute value together with its TraceQL type
+// (string, int, float, bool, duration, status, kind or keyword)
+type TempoTagValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// NewTempoTagValuesTool creates and returns a tool for looking up the values of a Tempo attribute
+func NewTempoTagValuesTool() mcp.Tool {
+	return mcp.NewTool("tempo_tag_values",
+		append(
+			common.ConnectionParams(),
+			mcp.WithDescription("List the values of an attribute in Grafana Tempo, e.g. which resource.service.name or span.http.route values exist. "+
+				"Use it to autocomplete TraceQL filters for tempo_query."),
+			mcp.WithString("tag",
+				mcp.Required(),
+				mcp.Description("Scoped attribute name, e.g. resource.service.name, span.http.route, status or name"),
+			),
+			mcp.WithString("query",
+				mcp.Description("TraceQL filter restricting the values to spans matching it, e.g. {resource.service.name=\"frontend\"}"),
+			),
+			mcp.WithString("start",
+				mcp.Description("Start time of the search window (default: Tempo's recent data)"),
+			),
+			mcp.WithString("end",
+				mcp.Description("End time of the search window (default: now)"),
+			),
+			mcp.WithNumber("limit",
+				mcp.Description("Maximum number of values to return (default: 100)"),
+			),
+		)...,
+	)
+}
+
+// HandleTempoTagValues handles Tempo tag value lookup tool requests
+func HandleTempoTagValues(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tag, ok := request.GetArguments()["tag"].(string)
+	if !ok || tag == "" {
+		return nil, fmt.Errorf("tag is required")
+	}
+	query, _ := request.GetArguments()["query"].(string)
+	logger.Printf("Received Tempo tag values request - tag: %q, query: %q", tag, query)
+
+	limit := 100
+	if limitVal, ok := request.GetArguments()["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	params, err := searchWindowParams(request)
+	if err != nil {
+		return nil, err
+	}
+	if query != "" {
+		params.Set("q", query)
+	}
+
+	values, err := fetchTempoTagValues(ctx, request, tag, params, query == "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+	}
+
+	logger.Printf("Tag values request returned %d values", len(values))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: formatTempoTagValues(tag, values, limit),
+			},
+		},
+	}, nil
+}
+
+// fetchTempoTagValues queries the v2 tag values endpoint, falling back to the
+// v1 endpoint for Tempo versions that predate it when allowFallback is set.
+// Values returned by the v1 endpoint are untyped and reported as strings.
+func fetchTempoTagValues(ctx context.Context, request mcp.CallToolRequest, tag string, params url.Values, allowFallback bool) ([]TempoTagValue, error) {
+	client, err := common.ClientForRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := client.GetCached(ctx, logger, common.CacheTags, func(tempoURL string) (string, error) {
+		return buildTempoAPIURL(tempoURL, fmt.Sprintf("/api/v2/search/tag/%s/values", url.PathEscape(tag)), params)
+	})
+	if err == nil {
+		var result TempoTagValuesV2Result
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse tag values response: %v", err)
+		}
+		return result.TagValues, nil
+	}
+
+	var httpErr *common.HTTPError
+	if !allowFallback || !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	// The v1 endpoint expects unscoped attribute names
+	unscoped := tag
+	for _, prefix := range []string{"resource.", "span.", "."} {
+		unscoped = strings.TrimPrefix(unscoped, prefix)
+	}
+
+	logger.Printf("v2 tag values endpoint not available, falling back to /api/search/tag/%s/values", unscoped)
+	body, err = client.GetCached(ctx, logger, common.CacheTags, func(tempoURL string) (string, error) {
+		return buildTempoAPIURL(tempoURL, fmt.Sprintf("/api/search/tag/%s/values", url.PathEscape(unscoped)), params)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result TempoTagValuesResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse tag values response: %v", err)
+	}
+	values := make([]TempoTagValue, 0, len(result.TagValues))
+	for _, v := range result.TagValues {
+		values = append(values, TempoTagValue{Type: "string", Value: v})
+	}
+	return values, nil
+}
+
+// formatTempoTagValues formats the tag values into a readable string, showing
+// at most limit values
+func formatTempoTagValues(tag string, values []TempoTagValue, limit int) string {
+	if len(values) == 0 {
+		return fmt.Sprintf("No values found for %s", tag)
+	}
+
+	sorted := append([]TempoTagValue(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Type != sorted[j].Type {
+			return sorted[i].Type < sorted[j].Type
+		}
+		return sorted[i].Value < sorted[j].Value
+	})
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d values for %s:\n\n", len(sorted), tag))
+
+	for i, v := range sorted {
+		if i >= limit {
+			output.WriteString(fmt.Sprintf("... %d more values not shown (increase limit or narrow the query)\n", len(sorted)-limit))
+			break
+		}
+		output.WriteString(fmt.Sprintf("  %s (%s)\n", formatTraceQLValue(v), v.Type))
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// formatTraceQLValue renders a value the way it would be written in a TraceQL
+// filter, quoting strings and leaving typed literals as they are
+func formatTraceQLValue(v TempoTagValue) string {
+	if v.Type == "string" {
+		return fmt.Sprintf("%q", v.Value)
+	}
+	return v.Value
+}
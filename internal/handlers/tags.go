@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/scottlepp/tempo-mcp-server/internal/common"
+)
+
+// TempoTagsResult represents the response of Tempo's /api/search/tags endpoint
+type TempoTagsResult struct {
+	TagNames []string `json:"tagNames"`
+}
+
+// TempoTagsV2Result represents the response of Tempo's /api/v2/search/tags endpoint
+type TempoTagsV2Result struct {
+	Scopes []TempoTagScope `json:"scopes"`
+}
+
+// TempoTagScope is a group of attribute names sharing a TraceQL scope
+type TempoTagScope struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// validTagScopes lists the scopes accepted by the tags endpoints
+var validTagScopes = []string{"span", "resource", "intrinsic", "event", "link", "instrumentation"}
+
+// NewTempoTagsTool creates and returns a tool for discovering attribute names in Tempo
+func NewTempoTagsTool() mcp.Tool {
+	return mcp.NewTool("tempo_tags",
+		append(
+			common.ConnectionParams(),
+			mcp.WithDescription("List the span, resource and intrinsic attribute names available in Grafana Tempo. "+
+				"Use it to discover which attributes exist before writing a TraceQL query for tempo_query."),
+			mcp.WithString("scope",
+				mcp.Description("Only return attributes of this scope: span, resource, intrinsic, event, link or instrumentation (default: all)"),
+				mcp.Enum(validTagScopes...),
+			),
+			mcp.WithString("query",
+				mcp.Description("TraceQL filter restricting the tags to spans matching it, e.g. {resource.service.name=\"frontend\"}"),
+			),
+			mcp.WithString("start",
+				mcp.Description("Start time of the search window (default: Tempo's recent data)"),
+			),
+			mcp.WithString("end",
+				mcp.Description("End time of the search window (default: now)"),
+			),
+		)...,
+	)
+}
+
+// HandleTempoTags handles Tempo tag discovery tool requests
+func HandleTempoTags(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	scope, _ := request.GetArguments()["scope"].(string)
+	query, _ := request.GetArguments()["query"].(string)
+	logger.Printf("Received Tempo tags request - scope: %q, query: %q", scope, query)
+
+	if scope != "" && !slices.Contains(validTagScopes, scope) {
+		return nil, fmt.Errorf("invalid scope %q (expected one of %s)", scope, strings.Join(validTagScopes, ", "))
+	}
+
+	params, err := searchWindowParams(request)
+	if err != nil {
+		return nil, err
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+	if query != "" {
+		params.Set("q", query)
+	}
+
+	scopes, err := fetchTempoTags(ctx, request, params, query == "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+	}
+
+	logger.Printf("Tags request returned %d scopes", len(scopes))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: formatTempoTags(scopes),
+			},
+		},
+	}, nil
+}
+
+// fetchTempoTags queries the v2 tags endpoint, falling back to the v1 endpoint
+// for Tempo versions that predate it when allowFallback is set
+func fetchTempoTags(ctx context.Context, request mcp.CallToolRequest, params url.Values, allowFallback bool) ([]TempoTagScope, error) {
+	client, err := common.ClientForRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := client.GetCached(ctx, logger, common.CacheTags, func(tempoURL string) (string, error) {
+		return buildTempoAPIURL(tempoURL, "/api/v2/search/tags", params)
+	})
+	if err == nil {
+		var result TempoTagsV2Result
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse tags response: %v", err)
+		}
+		return result.Scopes, nil
+	}
+
+	var httpErr *common.HTTPError
+	if !allowFallback || !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	logger.Printf("v2 tags endpoint not available, falling back to /api/search/tags")
+	body, err = client.GetCached(ctx, logger, common.CacheTags, func(tempoURL string) (string, error) {
+		return buildTempoAPIURL(tempoURL, "/api/search/tags", params)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result TempoTagsResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse tags response: %v", err)
+	}
+	name := params.Get("scope")
+	if name == "" {
+		name = "all"
+	}
+	return []TempoTagScope{{Name: name, Tags: result.TagNames}}, nil
+}
+
+// formatTempoTags formats the tag scopes into a readable string
+func formatTempoTags(scopes []TempoTagScope) string {
+	total := 0
+	for _, scope := range scopes {
+		total += len(scope.Tags)
+	}
+	if total == 0 {
+		return "No tags found"
+	}
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Found %d tags:\n", total))
+
+	for _, scope := range scopes {
+		if len(scope.Tags) == 0 {
+			continue
+		}
+		tags := append([]string(nil), scope.Tags...)
+		sort.Strings(tags)
+
+		output.WriteString(fmt.Sprintf("\n%s (%d):\n", scope.Name, len(tags)))
+		for _, tag := range tags {
+			output.WriteString(fmt.Sprintf("  %s\n", tag))
+		}
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// searchWindowParams converts the optional start and end arguments into the
+// Unix epoch second parameters understood by Tempo's search endpoints
+func searchWindowParams(request mcp.CallToolRequest) (url.Values, error) {
+	params := url.Values{}
+
+	startTime, ok, err := parseTimeArg(request, "start")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		params.Set("start", fmt.Sprintf("%d", startTime.Unix()))
+	}
+
+	endTime, ok, err := parseTimeArg(request, "end")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		params.Set("end", fmt.Sprintf("%d", endTime.Unix()))
+	}
+
+	return params, nil
+}
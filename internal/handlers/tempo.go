@@ -20,9 +20,19 @@ var logger = log.New(os.Stderr, "[tempo-mcp] ", log.LstdFlags)
 
 // TempoResult represents the structure of Tempo query results
 type TempoResult struct {
-	Traces      []TempoTrace `json:"traces"`
-	Metrics     interface{}  `json:"metrics,omitempty"`
-	ErrorStatus string       `json:"error,omitempty"`
+	Traces      []TempoTrace        `json:"traces"`
+	Metrics     *TempoSearchMetrics `json:"metrics,omitempty"`
+	ErrorStatus string              `json:"error,omitempty"`
+}
+
+// TempoSearchMetrics describes how much data Tempo inspected to answer a search
+type TempoSearchMetrics struct {
+	InspectedTraces jsonInt64 `json:"inspectedTraces"`
+	InspectedBytes  jsonInt64 `json:"inspectedBytes"`
+	TotalBlocks     jsonInt64 `json:"totalBlocks"`
+	CompletedJobs   jsonInt64 `json:"completedJobs"`
+	TotalJobs       jsonInt64 `json:"totalJobs"`
+	TotalBlockBytes jsonInt64 `json:"totalBlockBytes"`
 }
 
 // TempoTrace represents a single trace in the result
@@ -32,11 +42,52 @@ type TempoTrace struct {
 	RootTraceName     string            `json:"rootTraceName"`
 	StartTimeUnixNano string            `json:"startTimeUnixNano"`
 	DurationMs        int64             `json:"durationMs"`
-	SpanSet           interface{}       `json:"spanSet,omitempty"`
+	SpanSet           *TempoSpanSet     `json:"spanSet,omitempty"`
+	SpanSets          []TempoSpanSet    `json:"spanSets,omitempty"`
 	Attributes        map[string]string `json:"attributes,omitempty"`
 }
 
+// QueryResult is the structured content returned by the query tool
+type QueryResult struct {
+	Query           string              `json:"query,omitempty"`
+	Tags            string              `json:"tags,omitempty"`
+	Start           time.Time           `json:"start"`
+	End             time.Time           `json:"end"`
+	Limit           int                 `json:"limit"`
+	SpansPerSpanSet int                 `json:"spss,omitempty"`
+	MinDuration     string              `json:"minDuration,omitempty"`
+	MaxDuration     string              `json:"maxDuration,omitempty"`
+	Traces          []QueryTrace        `json:"traces"`
+	Metrics         *TempoSearchMetrics `json:"metrics,omitempty"`
+	// NextCursor is set when more traces may match; pass it as the cursor
+	// argument to fetch the next page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
 
+// searchOptions holds the parameters of a Tempo search request. Query is a
+// TraceQL query, Tags a legacy logfmt tag search; Start and End are Unix
+// epoch seconds. The options are stored in pagination cursors.
+type searchOptions struct {
+	Query           string `json:"q,omitempty"`
+	Tags            string `json:"tags,omitempty"`
+	Start           int64  `json:"start"`
+	End             int64  `json:"end"`
+	Limit           int    `json:"limit"`
+	SpansPerSpanSet int    `json:"spss,omitempty"`
+	MinDuration     string `json:"minDuration,omitempty"`
+	MaxDuration     string `json:"maxDuration,omitempty"`
+}
+
+// QueryTrace is a single trace of the structured query result
+type QueryTrace struct {
+	TraceID    string            `json:"traceID"`
+	Service    string            `json:"service"`
+	Name       string            `json:"name"`
+	Start      *time.Time        `json:"start,omitempty"`
+	DurationMs int64             `json:"durationMs"`
+	SpanSets   []QuerySpanSet    `json:"spanSets,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
 
 // NewTempoQueryTool creates and returns a tool for querying Grafana Tempo
 func NewTempoQueryTool() mcp.Tool {
@@ -44,9 +95,22 @@ func NewTempoQueryTool() mcp.Tool {
 		append(
 			common.ConnectionParams(),
 			mcp.WithDescription("Run a query against Grafana Tempo"),
+			mcp.WithOutputSchema[QueryResult](),
 			mcp.WithString("query",
-				mcp.Required(),
-				mcp.Description("Tempo query string"),
+				mcp.Description("TraceQL query, e.g. {resource.service.name=\"frontend\" && status=error}. Either query or tags is required."),
+			),
+			mcp.WithString("tags",
+				mcp.Description("Legacy tag-based search in logfmt form, e.g. service.name=frontend http.status_code=500, "+
+					"for Tempo versions or datasets without TraceQL support"),
+			),
+			mcp.WithString("min_duration",
+				mcp.Description("Only return traces at least this long, e.g. 100ms or 2s"),
+			),
+			mcp.WithString("max_duration",
+				mcp.Description("Only return traces at most this long, e.g. 5s"),
+			),
+			mcp.WithNumber("spss",
+				mcp.Description("Maximum number of matching spans returned per spanset (default: 3, chosen by Tempo)"),
 			),
 			mcp.WithString("start",
 				mcp.Description("Start time for the query (default: 1h ago)"),
@@ -57,68 +121,128 @@ func NewTempoQueryTool() mcp.Tool {
 			mcp.WithNumber("limit",
 				mcp.Description("Maximum number of traces to return (default: 20)"),
 			),
-		)...
+			mcp.WithBoolean("stream",
+				mcp.Description("Run the search over Tempo's gRPC streaming API, reporting traces as progress while the search runs. "+
+					"Use it for long searches that would otherwise time out (default: the datasource's streaming setting)"),
+			),
+			mcp.WithBoolean("paginate",
+				mcp.Description("Return a cursor for fetching older traces when more traces match than the limit allows. "+
+					"Sends the TraceQL query with the most_recent=true hint, which makes Tempo search every block in the time range (default: false)"),
+			),
+			mcp.WithString("cursor",
+				mcp.Description("Cursor returned by a previous tempo_query call to fetch the next, older page of results. "+
+					"The query and its other parameters are taken from the cursor."),
+			),
+		)...,
 	)
 }
 
 // HandleTempoQuery handles Tempo query tool requests
 func HandleTempoQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Extract parameters
-	queryString := request.Params.Arguments["query"].(string)
-	logger.Printf("Received Tempo query request: %s", queryString)
-
-
-
-	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-	limit := 20
-
-	// Override defaults if parameters are provided
-	if startStr, ok := request.Params.Arguments["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+	progress := newProgressReporter(ctx, request)
+	defer progress.finish()
+
+	var cursor searchCursor
+	paginate, _ := request.GetArguments()["paginate"].(bool)
+	token, _ := request.GetArguments()["cursor"].(string)
+	if token != "" {
+		var err error
+		if cursor, err = decodeCursor(token); err != nil {
+			return nil, err
+		}
+		paginate = true
+		logger.Printf("Continuing Tempo query from cursor - query: %q, tags: %q", cursor.Query, cursor.Tags)
+	} else {
+		opts, err := searchOptionsFromRequest(request)
 		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+			return nil, err
 		}
-		start = startTime.Unix()
+		cursor.searchOptions = opts
 	}
+	opts := cursor.searchOptions
 
-	if endStr, ok := request.Params.Arguments["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
+	logger.Printf("Query parameters - start: %d, end: %d, limit: %d", opts.Start, opts.End, opts.Limit)
+
+	// Ask for as many more traces as are excluded, so that a full page remains.
+	// When paging, ask for the most recent ones, so that the next page can
+	// continue from the oldest trace of this one.
+	requested := opts
+	requested.Limit += len(cursor.Exclude)
+	if paginate {
+		requested.Query = withMostRecentHint(requested.Query)
+	}
+
+	client, err := common.ClientForRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := newCursorScope(client.Datasource())
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		if err := cursor.checkScope(scope); err != nil {
+			return nil, err
 		}
-		end = endTime.Unix()
+	} else {
+		cursor.cursorScope = scope
 	}
 
-	if limitVal, ok := request.Params.Arguments["limit"].(float64); ok {
-		limit = int(limitVal)
+	stream := client.Datasource().Streaming
+	if streamArg, ok := request.GetArguments()["stream"].(bool); ok {
+		stream = streamArg
 	}
 
-	logger.Printf("Query parameters - start: %d, end: %d, limit: %d", start, end, limit)
+	var result *TempoResult
+	if stream {
+		result, err = streamTempoSearch(ctx, progress, client, requested)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Build query URL
+		body, err := client.Get(progress.trackRequest(ctx), logger, func(tempoURL string) (string, error) {
+			return buildTempoQueryURL(tempoURL, requested)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+		}
 
-	// Build query URL
-	body, err := common.MakeTempoRequest(ctx, logger, request, func(tempoURL string) (string, error) {
-		return buildTempoQueryURL(tempoURL, queryString, start, end, limit)
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
+		progress.step(fmt.Sprintf("Parsing %s of search results", formatBytes(int64(len(body)))))
+		// Execute query with authentication
+		result, err = parseTempoResponse(ctx, body)
+		if err != nil {
+			logger.Printf("Query execution error: %v", err)
+			return nil, fmt.Errorf("query execution failed: %v", err)
+		}
 	}
 
-	// Execute query with authentication
-	result, err := parseTempoResponse(ctx, body)
-	if err != nil {
-		logger.Printf("Query execution error: %v", err)
-		return nil, fmt.Errorf("query execution failed: %v", err)
+	// A full result means Tempo stopped at the limit and more traces may match
+	more := len(result.Traces) >= requested.Limit
+	result.Traces = pageTraces(result.Traces, cursor.Exclude, opts.Limit)
+
+	// Searches by tags alone cannot ask for the most recent traces and are not paged
+	var nextCursor string
+	if next, ok := nextSearchCursor(cursor, result.Traces); paginate && more && ok && opts.Query != "" {
+		if nextCursor, err = encodeCursor(next); err != nil {
+			return nil, fmt.Errorf("failed to create cursor: %v", err)
+		}
 	}
 
 	// Format text result
+	progress.step(fmt.Sprintf("Formatting %d traces", len(result.Traces)))
 	formattedTextResult, err := formatTempoResults(result)
 	if err != nil {
 		return nil, fmt.Errorf("failed to format results: %v", err)
 	}
+	if nextCursor != "" {
+		formattedTextResult += fmt.Sprintf("\n\nMore results available: call tempo_query again with cursor %q to fetch older traces.", nextCursor)
+	} else if more && !paginate && opts.Query != "" {
+		formattedTextResult += "\n\nMore traces may match: narrow the query or time range, or repeat the query with paginate=true to page through the most recent traces."
+	}
 
-	// Create result with text content - use the right format for the tool result
+	// Create result with text content for the model and the same traces as
+	// structured content for programmatic clients
 	toolResult := &mcp.CallToolResult{
 		Content: []mcp.Content{
 			mcp.TextContent{
@@ -126,6 +250,19 @@ func HandleTempoQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 				Text: formattedTextResult,
 			},
 		},
+		StructuredContent: &QueryResult{
+			Query:           opts.Query,
+			Tags:            opts.Tags,
+			Start:           time.Unix(opts.Start, 0).UTC(),
+			End:             time.Unix(opts.End, 0).UTC(),
+			Limit:           opts.Limit,
+			SpansPerSpanSet: opts.SpansPerSpanSet,
+			MinDuration:     opts.MinDuration,
+			MaxDuration:     opts.MaxDuration,
+			Traces:          convertTempoTraces(result.Traces),
+			Metrics:         result.Metrics,
+			NextCursor:      nextCursor,
+		},
 	}
 
 	// Log summary to stderr
@@ -134,6 +271,60 @@ func HandleTempoQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	return toolResult, nil
 }
 
+// searchOptionsFromRequest builds the search parameters from the tool arguments
+func searchOptionsFromRequest(request mcp.CallToolRequest) (searchOptions, error) {
+	// Extract parameters
+	queryString, _ := request.GetArguments()["query"].(string)
+	tags, _ := request.GetArguments()["tags"].(string)
+	if queryString == "" && tags == "" {
+		return searchOptions{}, fmt.Errorf("query or tags is required")
+	}
+	logger.Printf("Received Tempo query request - query: %q, tags: %q", queryString, tags)
+
+	// Set defaults for optional parameters
+	opts := searchOptions{
+		Query: queryString,
+		Tags:  tags,
+		Start: time.Now().Add(-1 * time.Hour).Unix(),
+		End:   time.Now().Unix(),
+		Limit: 20,
+	}
+
+	// Override defaults if parameters are provided
+	if startTime, ok, err := parseTimeArg(request, "start"); err != nil {
+		return searchOptions{}, err
+	} else if ok {
+		opts.Start = startTime.Unix()
+	}
+
+	if endTime, ok, err := parseTimeArg(request, "end"); err != nil {
+		return searchOptions{}, err
+	} else if ok {
+		opts.End = endTime.Unix()
+	}
+
+	if limitVal, ok := request.GetArguments()["limit"].(float64); ok && limitVal > 0 {
+		opts.Limit = int(limitVal)
+	}
+
+	if spssVal, ok := request.GetArguments()["spss"].(float64); ok {
+		if spssVal < 1 {
+			return searchOptions{}, fmt.Errorf("spss must be at least 1")
+		}
+		opts.SpansPerSpanSet = int(spssVal)
+	}
+
+	var err error
+	if opts.MinDuration, err = durationArg(request, "min_duration"); err != nil {
+		return searchOptions{}, err
+	}
+	if opts.MaxDuration, err = durationArg(request, "max_duration"); err != nil {
+		return searchOptions{}, err
+	}
+
+	return opts, nil
+}
+
 // parseTime converts a time string to a time.Time
 func parseTime(timeStr string) (time.Time, error) {
 	// Handle "now" keyword
@@ -172,31 +363,85 @@ func parseTime(timeStr string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("unsupported time format: %s", timeStr)
 }
 
+// parseTimeArg parses an optional time argument of the tool request. The
+// boolean result is false when the argument was not provided.
+func parseTimeArg(request mcp.CallToolRequest, name string) (time.Time, bool, error) {
+	value, ok := request.GetArguments()[name].(string)
+	if !ok || value == "" {
+		return time.Time{}, false, nil
+	}
+	t, err := parseTime(value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s time: %v", name, err)
+	}
+	return t, true, nil
+}
+
+// durationArg returns an optional duration argument such as 100ms after
+// checking that Tempo will be able to parse it
+func durationArg(request mcp.CallToolRequest, name string) (string, error) {
+	value, _ := request.GetArguments()[name].(string)
+	if value == "" {
+		return "", nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if duration < 0 {
+		return "", fmt.Errorf("invalid %s: %s is negative", name, value)
+	}
+	return value, nil
+}
+
+// buildTempoAPIURL appends an API path to the Tempo base URL and encodes the
+// given query parameters
+func buildTempoAPIURL(baseURL, apiPath string, params url.Values) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + apiPath
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
 // buildTempoQueryURL constructs the Tempo query URL
-func buildTempoQueryURL(baseURL, query string, start, end int64, limit int) (string, error) {
+func buildTempoQueryURL(baseURL string, opts searchOptions) (string, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return "", err
 	}
 
-	// Path for Tempo search API
+	// Path for Tempo search API, appended to any base path such as the one
+	// of a Grafana datasource proxy
 	if !strings.Contains(u.Path, "/api/search") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = "/api/search"
-		} else {
-			u.Path = fmt.Sprintf("%s/api/search", u.Path)
-		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/search"
 	}
 
 	// Add query parameters
 	q := u.Query()
-	q.Set("q", query)
+	if opts.Query != "" {
+		q.Set("q", opts.Query)
+	}
+	if opts.Tags != "" {
+		q.Set("tags", opts.Tags)
+	}
 
 	// Just use Unix epoch seconds directly - no conversion needed
 	// The API expects raw seconds since epoch
-	q.Set("start", fmt.Sprintf("%d", start))
-	q.Set("end", fmt.Sprintf("%d", end))
-	q.Set("limit", fmt.Sprintf("%d", limit))
+	q.Set("start", fmt.Sprintf("%d", opts.Start))
+	q.Set("end", fmt.Sprintf("%d", opts.End))
+	q.Set("limit", fmt.Sprintf("%d", opts.Limit))
+	if opts.SpansPerSpanSet > 0 {
+		q.Set("spss", fmt.Sprintf("%d", opts.SpansPerSpanSet))
+	}
+	if opts.MinDuration != "" {
+		q.Set("minDuration", opts.MinDuration)
+	}
+	if opts.MaxDuration != "" {
+		q.Set("maxDuration", opts.MaxDuration)
+	}
 	u.RawQuery = q.Encode()
 
 	return u.String(), nil
@@ -299,20 +544,54 @@ func cleanTempoResponse(input []byte) []byte {
 	return []byte(responseStr)
 }
 
+// convertTempoTraces converts Tempo's search results into the structured result form
+func convertTempoTraces(traces []TempoTrace) []QueryTrace {
+	converted := make([]QueryTrace, 0, len(traces))
+	for _, trace := range traces {
+		out := QueryTrace{
+			TraceID:    trace.TraceID,
+			Service:    trace.RootServiceName,
+			Name:       trace.RootTraceName,
+			DurationMs: trace.DurationMs,
+			SpanSets:   convertSpanSets(trace.matchedSpanSets()),
+			Attributes: trace.Attributes,
+		}
+		if start, ok := parseUnixNano(trace.StartTimeUnixNano); ok {
+			start = start.UTC()
+			out.Start = &start
+		}
+		converted = append(converted, out)
+	}
+	return converted
+}
+
+// parseUnixNano parses a nanosecond timestamp encoded as a decimal string
+// into the server's local time, as shown in the text results
+func parseUnixNano(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ts), true
+}
+
 // formatTempoResults formats the Tempo query results into a readable string
 func formatTempoResults(result *TempoResult) (string, error) {
 	logger.Printf("Formatting result with %d traces", len(result.Traces))
 
+	if result.Metrics != nil {
+		logger.Printf("Search metrics: %+v", *result.Metrics)
+	}
+
 	if len(result.Traces) == 0 {
-		// Log metrics data if present
-		if result.Metrics != nil {
-			logger.Printf("Metrics data: %+v", result.Metrics)
-		}
-		return "No traces found matching the query", nil
+		return "No traces found matching the query" + formatSearchMetrics(result.Metrics), nil
 	}
 
 	var output strings.Builder
-	output.WriteString(fmt.Sprintf("Found %d traces:\n\n", len(result.Traces)))
+	output.WriteString(fmt.Sprintf("Found %d traces%s:\n\n", len(result.Traces), formatSearchMetrics(result.Metrics)))
 
 	for i, trace := range result.Traces {
 		// Format trace information
@@ -322,12 +601,8 @@ func formatTempoResults(result *TempoResult) (string, error) {
 		output.WriteString(fmt.Sprintf("  Name: %s\n", trace.RootTraceName))
 
 		// Parse timestamp if available
-		if trace.StartTimeUnixNano != "" {
-			ts, err := strconv.ParseInt(trace.StartTimeUnixNano, 10, 64)
-			if err == nil {
-				timestamp := time.Unix(0, ts)
-				output.WriteString(fmt.Sprintf("  Start Time: %s\n", timestamp.Format(time.RFC3339)))
-			}
+		if timestamp, ok := parseUnixNano(trace.StartTimeUnixNano); ok {
+			output.WriteString(fmt.Sprintf("  Start Time: %s\n", timestamp.Format(time.RFC3339)))
 		}
 
 		output.WriteString(fmt.Sprintf("  Duration: %d ms\n", trace.DurationMs))
@@ -340,6 +615,9 @@ func formatTempoResults(result *TempoResult) (string, error) {
 			}
 		}
 
+		// Add the spans that matched the TraceQL filter
+		formatSpanSets(&output, trace.matchedSpanSets())
+
 		output.WriteString("\n")
 	}
 
@@ -351,6 +629,16 @@ func formatTempoResults(result *TempoResult) (string, error) {
 	return formattedOutput, nil
 }
 
+// formatSearchMetrics summarizes the search metrics as a parenthesized suffix,
+// or returns an empty string when Tempo did not report any
+func formatSearchMetrics(metrics *TempoSearchMetrics) string {
+	if metrics == nil || (metrics.InspectedTraces == 0 && metrics.InspectedBytes == 0) {
+		return ""
+	}
+	return fmt.Sprintf(" (inspected %d traces, %d bytes in %d blocks)",
+		metrics.InspectedTraces, metrics.InspectedBytes, metrics.TotalBlocks)
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
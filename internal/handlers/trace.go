@@ -3,10 +3,14 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/scottlepp/tempo-mcp-server/internal/common"
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
 )
 
 func NewTempoTraceTool() mcp.Tool {
@@ -21,30 +25,48 @@ func NewTempoTraceTool() mcp.Tool {
 			mcp.WithString("filename",
 				mcp.Description("Filename to save the JSON trace data to"),
 			),
-		)...
+			mcp.WithString("format",
+				mcp.Description("Output format: tree renders the span hierarchy with service, duration, start offset and status, "+
+					"errors returns only the failing spans with their callers and exceptions, raw returns the JSON returned by Tempo (default: tree)"),
+				mcp.Enum(TraceFormatTree, TraceFormatErrors, TraceFormatRaw),
+			),
+			mcp.WithNumber("max_spans",
+				mcp.Description(fmt.Sprintf("Maximum number of spans to render in the tree (default: %d)", defaultMaxTreeSpans)),
+			),
+		)...,
 	)
 }
 
 func HandleTempoTrace(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	traceID := request.Params.Arguments["trace_id"].(string)
 	var filename string
-	argFilename, ok := request.Params.Arguments["filename"].(string)
+	argFilename, ok := request.GetArguments()["filename"].(string)
 	if ok {
 		filename = argFilename
 	}
 
-	logger.Printf("Received Tempo trace request: %s", traceID)
-
 	// Extract parameters
-	traceID, success := request.Params.Arguments["trace_id"].(string)
-	if !success {
+	traceID, success := request.GetArguments()["trace_id"].(string)
+	if !success || traceID == "" {
 		return nil, fmt.Errorf("trace_id is required")
 	}
+
+	format := TraceFormatTree
+	if formatArg, ok := request.GetArguments()["format"].(string); ok && formatArg != "" {
+		if formatArg != TraceFormatTree && formatArg != TraceFormatErrors && formatArg != TraceFormatRaw {
+			return nil, fmt.Errorf("invalid format %q (expected %s, %s or %s)", formatArg, TraceFormatTree, TraceFormatErrors, TraceFormatRaw)
+		}
+		format = formatArg
+	}
+
+	maxSpans := defaultMaxTreeSpans
+	if maxSpansVal, ok := request.GetArguments()["max_spans"].(float64); ok && maxSpansVal > 0 {
+		maxSpans = int(maxSpansVal)
+	}
 	logger.Printf("Received Tempo trace request: %s", traceID)
+	progress := newProgressReporter(ctx, request)
+	defer progress.finish()
 
-	body, err := common.MakeTempoRequest(ctx, logger, request, func(tempoURL string) (string, error) {
-		return buildTempoTraceURL(tempoURL, traceID), nil
-	})
+	body, parsed, err := fetchTempoTrace(progress.trackRequest(ctx), request, traceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to make Tempo request: %v", err)
 	}
@@ -56,8 +78,20 @@ func HandleTempoTrace(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 			return nil, fmt.Errorf("failed to save trace to file: %v", err)
 		}
 		responseText = fmt.Sprintf("Trace saved to %s", filename)
-	} else {
+	} else if format == TraceFormatRaw {
 		responseText = string(body)
+	} else {
+		progress.step(fmt.Sprintf("Parsing %s trace", formatBytes(int64(len(body)))))
+		trace, err := parseFetchedTrace(body, parsed)
+		if err != nil {
+			return nil, err
+		}
+		progress.step(fmt.Sprintf("Formatting %d spans", len(trace.Spans())))
+		if format == TraceFormatErrors {
+			responseText = formatTraceErrors(traceID, trace)
+		} else {
+			responseText = formatTraceTree(traceID, trace, maxSpans)
+		}
 	}
 
 	return &mcp.CallToolResult{
@@ -70,6 +104,94 @@ func HandleTempoTrace(ctx context.Context, request mcp.CallToolRequest) (*mcp.Ca
 	}, nil
 }
 
+// recentTraceWindow is how long after its last span ended a trace may still
+// receive spans, e.g. from services flushing late or from ingesters that have
+// not yet combined all parts of the trace
+const recentTraceWindow = 5 * time.Minute
+
+// fetchTempoTrace retrieves the raw trace payload for the given trace ID,
+// reusing a recently fetched copy of the trace when available. A trace fetched
+// from Tempo is parsed to decide whether it can be cached, and is returned
+// parsed too, so that callers do not parse it again; the parsed trace is nil
+// for cached payloads.
+func fetchTempoTrace(ctx context.Context, request mcp.CallToolRequest, traceID string) ([]byte, *otlp.Trace, error) {
+	client, err := common.ClientForRequest(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	var parsed *otlp.Trace
+	body, err := client.GetCachedIf(ctx, logger, common.CacheTrace, func(body []byte) bool {
+		trace, err := otlp.Parse(body)
+		if err != nil {
+			return false
+		}
+		parsed = trace
+		return isCompleteTrace(trace)
+	}, func(tempoURL string) (string, error) {
+		return buildTempoTraceURL(tempoURL, traceID), nil
+	})
+	return body, parsed, err
+}
+
+// parseFetchedTrace returns the trace fetched by fetchTempoTrace, parsing the
+// payload unless that was done already
+func parseFetchedTrace(body []byte, parsed *otlp.Trace) (*otlp.Trace, error) {
+	if parsed != nil {
+		return parsed, nil
+	}
+	return otlp.Parse(body)
+}
+
+// isCompleteTrace reports whether a fetched trace can be cached: traces whose
+// newest span ended within recentTraceWindow may still be incomplete and are
+// fetched again on the next request
+func isCompleteTrace(trace *otlp.Trace) bool {
+	if len(trace.Spans()) == 0 {
+		return false
+	}
+	_, end := trace.Bounds()
+	return time.Since(end) > recentTraceWindow
+}
+
+// maxTraceIssues bounds the number of invalid span fields listed in the summary
+const maxTraceIssues = 10
+
+// formatTraceSummary formats a one-paragraph overview of the trace
+func formatTraceSummary(traceID string, trace *otlp.Trace) string {
+	spans := trace.Spans()
+	if len(spans) == 0 {
+		return fmt.Sprintf("Trace %s contains no spans", traceID)
+	}
+
+	errorCount := 0
+	for _, span := range spans {
+		if span.IsError() {
+			errorCount++
+		}
+	}
+
+	start, _ := trace.Bounds()
+	services := trace.Services()
+
+	var output strings.Builder
+	output.WriteString(fmt.Sprintf("Trace %s:\n", traceID))
+	output.WriteString(fmt.Sprintf("  Spans: %d (%d with errors)\n", len(spans), errorCount))
+	output.WriteString(fmt.Sprintf("  Services (%d): %s\n", len(services), strings.Join(services, ", ")))
+	output.WriteString(fmt.Sprintf("  Start Time: %s\n", start.Format("2006-01-02T15:04:05.000Z07:00")))
+	output.WriteString(fmt.Sprintf("  Duration: %s", trace.Duration()))
+	if len(trace.Issues) > 0 {
+		output.WriteString(fmt.Sprintf("\n  Invalid span data (%d issues):", len(trace.Issues)))
+		for i, issue := range trace.Issues {
+			if i >= maxTraceIssues {
+				output.WriteString(fmt.Sprintf("\n    ... %d more issues not shown", len(trace.Issues)-maxTraceIssues))
+				break
+			}
+			output.WriteString("\n    - " + issue)
+		}
+	}
+	return output.String()
+}
+
 func buildTempoTraceURL(tempoURL, traceID string) string {
-	return fmt.Sprintf("%s/api/traces/%s", tempoURL, traceID)
-}
\ No newline at end of file
+	return fmt.Sprintf("%s/api/traces/%s", strings.TrimSuffix(tempoURL, "/"), url.PathEscape(traceID))
+}
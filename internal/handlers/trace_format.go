@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// Output formats supported by the trace tool
+const (
+	TraceFormatTree   = "tree"
+	TraceFormatErrors = "errors"
+	TraceFormatRaw    = "raw"
+)
+
+// defaultMaxTreeSpans bounds the number of spans rendered in the tree
+const defaultMaxTreeSpans = 500
+
+// maxStacktraceLines bounds the number of stacktrace lines shown per exception
+const maxStacktraceLines = 20
+
+// formatTraceTree renders the span hierarchy of the trace as an indented tree,
+// showing at most maxSpans spans
+func formatTraceTree(traceID string, trace *otlp.Trace, maxSpans int) string {
+	var output strings.Builder
+	output.WriteString(formatTraceSummary(traceID, trace))
+
+	spans := trace.Spans()
+	if len(spans) == 0 {
+		return output.String()
+	}
+
+	traceStart, _ := trace.Bounds()
+	tree := otlp.BuildTree(trace)
+	output.WriteString("\n\n")
+	if len(tree.Duplicates) > 0 {
+		output.WriteString(fmt.Sprintf("(%d spans reuse the ID of another span; their children are shown under the first one)\n", len(tree.Duplicates)))
+	}
+
+	rendered := 0
+	for _, root := range tree.Roots {
+		if rendered >= maxSpans {
+			break
+		}
+		if root.Span.ParentSpanID != "" {
+			output.WriteString(fmt.Sprintf("(parent span %s missing)\n", root.Span.ParentSpanID))
+		}
+		writeTreeNode(&output, root, "", "", traceStart, maxSpans, &rendered)
+	}
+
+	if rendered < len(spans) {
+		output.WriteString(fmt.Sprintf("... %d more spans not shown (increase max_spans to see them)\n", len(spans)-rendered))
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// writeTreeNode writes a node and its descendants. prefix is written before
+// the node itself, childPrefix before each of its descendants.
+func writeTreeNode(output *strings.Builder, node *otlp.Node, prefix, childPrefix string, traceStart time.Time, maxSpans int, rendered *int) {
+	if *rendered >= maxSpans {
+		return
+	}
+	*rendered++
+
+	output.WriteString(prefix)
+	output.WriteString(formatSpanLine(node.Span, traceStart))
+	output.WriteString("\n")
+
+	for i, child := range node.Children {
+		if i == len(node.Children)-1 {
+			writeTreeNode(output, child, childPrefix+"└─ ", childPrefix+"   ", traceStart, maxSpans, rendered)
+		} else {
+			writeTreeNode(output, child, childPrefix+"├─ ", childPrefix+"│  ", traceStart, maxSpans, rendered)
+		}
+	}
+}
+
+// formatTraceErrors renders only the failing spans of the trace. Spans whose
+// descendants did not fail are the likely origin of the error and are shown
+// with their callers and recorded exceptions; the remaining error spans are
+// listed as having propagated the error.
+func formatTraceErrors(traceID string, trace *otlp.Trace) string {
+	var output strings.Builder
+	output.WriteString(formatTraceSummary(traceID, trace))
+
+	traceStart, _ := trace.Bounds()
+	errorSpans := otlp.ErrorSpans(otlp.BuildTree(trace))
+	if len(errorSpans) == 0 {
+		output.WriteString("\n\nNo spans with an error status found")
+		return output.String()
+	}
+
+	var origins, propagated []otlp.ErrorNode
+	for _, e := range errorSpans {
+		if e.Leaf {
+			origins = append(origins, e)
+		} else {
+			propagated = append(propagated, e)
+		}
+	}
+
+	output.WriteString(fmt.Sprintf("\n\nFound %d error spans (likely origins: %d):\n", len(errorSpans), len(origins)))
+
+	for i, e := range origins {
+		output.WriteString(fmt.Sprintf("\nError %d: %s\n", i+1, formatSpanLine(e.Span, traceStart)))
+		output.WriteString(fmt.Sprintf("  Span ID: %s\n", e.Span.SpanID))
+
+		if ancestors := e.Ancestors(); len(ancestors) > 0 {
+			output.WriteString("  Callers:\n")
+			for depth, ancestor := range ancestors {
+				indent := strings.Repeat("   ", depth)
+				if depth > 0 {
+					indent = strings.Repeat("   ", depth-1) + "└─ "
+				}
+				output.WriteString(fmt.Sprintf("    %s%s\n", indent, formatSpanLine(ancestor.Span, traceStart)))
+			}
+		}
+
+		for _, exception := range e.Exceptions {
+			output.WriteString(fmt.Sprintf("  Exception: %s\n", formatException(exception)))
+			writeStacktrace(&output, exception.Stacktrace)
+		}
+	}
+
+	if len(propagated) > 0 {
+		output.WriteString("\nErrors propagated to callers:\n")
+		for _, e := range propagated {
+			output.WriteString(fmt.Sprintf("  %s\n", formatSpanLine(e.Span, traceStart)))
+			for _, exception := range e.Exceptions {
+				output.WriteString(fmt.Sprintf("    Exception: %s\n", formatException(exception)))
+			}
+		}
+	}
+
+	return strings.TrimSuffix(output.String(), "\n")
+}
+
+// formatException renders an exception as "type: message"
+func formatException(exception otlp.Exception) string {
+	switch {
+	case exception.Type != "" && exception.Message != "":
+		return exception.Type + ": " + exception.Message
+	case exception.Type != "":
+		return exception.Type
+	case exception.Message != "":
+		return exception.Message
+	default:
+		return "(no details recorded)"
+	}
+}
+
+// writeStacktrace writes the indented stacktrace, truncated to maxStacktraceLines
+func writeStacktrace(output *strings.Builder, stacktrace string) {
+	if stacktrace == "" {
+		return
+	}
+	lines := strings.Split(strings.TrimRight(stacktrace, "\n"), "\n")
+	for i, line := range lines {
+		if i >= maxStacktraceLines {
+			output.WriteString(fmt.Sprintf("      ... %d more lines\n", len(lines)-maxStacktraceLines))
+			break
+		}
+		output.WriteString(fmt.Sprintf("      %s\n", strings.TrimRight(line, "\r")))
+	}
+}
+
+// formatSpanLine renders a single span as
+// "name [service] duration @+offset kind status"
+func formatSpanLine(span *otlp.Span, traceStart time.Time) string {
+	line := fmt.Sprintf("%s [%s] %s @+%s",
+		span.Name,
+		span.ServiceName(),
+		formatSpanDuration(span.Duration()),
+		formatSpanDuration(span.StartTime().Sub(traceStart)))
+
+	if span.Kind != otlp.SpanKindUnspecified {
+		line += " " + span.Kind.String()
+	}
+
+	if span.IsError() {
+		line += " ERROR"
+		if span.Status.Message != "" {
+			line += ": " + span.Status.Message
+		}
+	}
+
+	return line
+}
+
+// formatSpanDuration renders a duration rounded to a readable precision
+func formatSpanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
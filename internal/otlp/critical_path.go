@@ -0,0 +1,158 @@
+package otlp
+
+import (
+	"sort"
+	"time"
+)
+
+// CriticalPathSegment is a stretch of time on the critical path during which
+// the given span was doing its own work (not waiting on a child)
+type CriticalPathSegment struct {
+	Span  *Span
+	Start uint64
+	End   uint64
+}
+
+// Duration returns the length of the segment
+func (s CriticalPathSegment) Duration() time.Duration {
+	return time.Duration(s.End - s.Start)
+}
+
+// CriticalPathSpan summarizes the contribution of a single span to the critical path
+type CriticalPathSpan struct {
+	Span *Span
+	// Depth of the span in the tree
+	Depth int
+	// SelfTime is the time the span spent outside of all its children
+	SelfTime time.Duration
+	// Contribution is the time the span accounts for on the critical path
+	Contribution time.Duration
+}
+
+// CriticalPath is the chain of spans determining the latency of a trace
+type CriticalPath struct {
+	Root     *Node
+	Total    time.Duration
+	Segments []CriticalPathSegment
+	// Spans on the critical path in the order they appear in the tree
+	Spans []CriticalPathSpan
+}
+
+// ComputeCriticalPath computes the critical path of the trace, starting at
+// its longest root span. Walking backwards from the end of a span, the child
+// that finished last is assumed to have blocked it; the time between that
+// child's end and the cursor is attributed to the span itself, and the walk
+// continues inside the child and then from the child's start. Child intervals
+// are clipped to their parent to tolerate clock skew.
+func ComputeCriticalPath(tree *Tree) *CriticalPath {
+	var root *Node
+	for _, node := range tree.Roots {
+		if root == nil || node.Span.Duration() > root.Span.Duration() {
+			root = node
+		}
+	}
+	if root == nil {
+		return &CriticalPath{}
+	}
+
+	path := &CriticalPath{Root: root, Total: root.Span.Duration()}
+	path.Segments = criticalSegments(root, root.Span.StartTimeUnixNano, root.Span.EndTimeUnixNano)
+
+	contributions := map[*Span]time.Duration{}
+	for _, segment := range path.Segments {
+		contributions[segment.Span] += segment.Duration()
+	}
+
+	root.walk(0, func(node *Node, depth int) bool {
+		contribution, ok := contributions[node.Span]
+		if !ok {
+			return true
+		}
+		path.Spans = append(path.Spans, CriticalPathSpan{
+			Span:         node.Span,
+			Depth:        depth,
+			SelfTime:     SelfTime(node),
+			Contribution: contribution,
+		})
+		return true
+	})
+
+	return path
+}
+
+// criticalSegments returns the critical path segments of the node within the
+// window [start, end], in chronological order
+func criticalSegments(node *Node, start, end uint64) []CriticalPathSegment {
+	start = max(start, node.Span.StartTimeUnixNano)
+	end = min(end, node.Span.EndTimeUnixNano)
+	if end <= start {
+		return nil
+	}
+
+	children := append([]*Node(nil), node.Children...)
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Span.EndTimeUnixNano > children[j].Span.EndTimeUnixNano
+	})
+
+	var reversed []CriticalPathSegment
+	cursor := end
+	for _, child := range children {
+		childStart := max(child.Span.StartTimeUnixNano, start)
+		childEnd := min(child.Span.EndTimeUnixNano, cursor)
+		if childEnd <= childStart {
+			// finished after the cursor moved past it, or outside the window
+			continue
+		}
+
+		if cursor > childEnd {
+			reversed = append(reversed, CriticalPathSegment{Span: node.Span, Start: childEnd, End: cursor})
+		}
+		childSegments := criticalSegments(child, childStart, childEnd)
+		for i := len(childSegments) - 1; i >= 0; i-- {
+			reversed = append(reversed, childSegments[i])
+		}
+		cursor = childStart
+		if cursor <= start {
+			break
+		}
+	}
+	if cursor > start {
+		reversed = append(reversed, CriticalPathSegment{Span: node.Span, Start: start, End: cursor})
+	}
+
+	segments := make([]CriticalPathSegment, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		segments = append(segments, reversed[i])
+	}
+	return segments
+}
+
+// SelfTime returns the time the span of the node spent outside of all its
+// children, i.e. its duration minus the union of its children's intervals
+func SelfTime(node *Node) time.Duration {
+	start, end := node.Span.StartTimeUnixNano, node.Span.EndTimeUnixNano
+	if end <= start {
+		return 0
+	}
+
+	type interval struct{ start, end uint64 }
+	var intervals []interval
+	for _, child := range node.Children {
+		s := max(child.Span.StartTimeUnixNano, start)
+		e := min(child.Span.EndTimeUnixNano, end)
+		if e > s {
+			intervals = append(intervals, interval{s, e})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+
+	var covered, coveredUntil uint64 = 0, start
+	for _, iv := range intervals {
+		if iv.end <= coveredUntil {
+			continue
+		}
+		covered += iv.end - max(iv.start, coveredUntil)
+		coveredUntil = iv.end
+	}
+	return time.Duration(end - start - covered)
+}
@@ -0,0 +1,156 @@
+package otlp
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeCriticalPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		spans    []testSpan
+		total    time.Duration
+		segments []string
+		// contributions lists the spans on the path as name@depth:contribution
+		contributions []string
+	}{
+		{
+			name: "sequential children",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "a", parent: "root", start: 10, end: 30},
+				{name: "b", parent: "root", start: 40, end: 90},
+			},
+			total:         100,
+			segments:      []string{"root:0-10", "a:10-30", "root:30-40", "b:40-90", "root:90-100"},
+			contributions: []string{"root@0:30ns", "a@1:20ns", "b@1:50ns"},
+		},
+		{
+			name: "parallel children block on the last to finish",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "slow", parent: "root", start: 10, end: 80},
+				{name: "fast", parent: "root", start: 20, end: 60},
+			},
+			total:         100,
+			segments:      []string{"root:0-10", "slow:10-80", "root:80-100"},
+			contributions: []string{"root@0:30ns", "slow@1:70ns"},
+		},
+		{
+			name: "nested children",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "a", parent: "root", start: 0, end: 100},
+				{name: "a1", parent: "a", start: 20, end: 70},
+			},
+			total:         100,
+			segments:      []string{"a:0-20", "a1:20-70", "a:70-100"},
+			contributions: []string{"a@1:50ns", "a1@2:50ns"},
+		},
+		{
+			name: "child outliving its parent is clipped",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "async", parent: "root", start: 50, end: 150},
+			},
+			total:         100,
+			segments:      []string{"root:0-50", "async:50-100"},
+			contributions: []string{"root@0:50ns", "async@1:50ns"},
+		},
+		{
+			name: "longest root is used",
+			spans: []testSpan{
+				{name: "short", start: 0, end: 10},
+				{name: "long", start: 5, end: 105},
+				{name: "orphan", parent: "missing", start: 0, end: 50},
+			},
+			total:         100,
+			segments:      []string{"long:5-105"},
+			contributions: []string{"long@0:100ns"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ComputeCriticalPath(BuildTree(buildFixture(t, tt.spans...)))
+			if path.Total != tt.total {
+				t.Errorf("Total = %s, want %s", path.Total, tt.total)
+			}
+
+			var segments []string
+			var sum time.Duration
+			for _, segment := range path.Segments {
+				segments = append(segments, fmt.Sprintf("%s:%d-%d", segment.Span.Name, segment.Start, segment.End))
+				sum += segment.Duration()
+			}
+			if !reflect.DeepEqual(segments, tt.segments) {
+				t.Errorf("Segments = %v, want %v", segments, tt.segments)
+			}
+			if sum != path.Total {
+				t.Errorf("segments add up to %s, want the total %s", sum, path.Total)
+			}
+
+			var contributions []string
+			for _, span := range path.Spans {
+				contributions = append(contributions, fmt.Sprintf("%s@%d:%s", span.Span.Name, span.Depth, span.Contribution))
+			}
+			if !reflect.DeepEqual(contributions, tt.contributions) {
+				t.Errorf("Spans = %v, want %v", contributions, tt.contributions)
+			}
+		})
+	}
+}
+
+func TestComputeCriticalPathEmpty(t *testing.T) {
+	path := ComputeCriticalPath(BuildTree(buildFixture(t)))
+	if path.Root != nil || path.Total != 0 || len(path.Segments) != 0 {
+		t.Errorf("critical path of an empty trace = %+v", path)
+	}
+}
+
+func TestSelfTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []testSpan
+		want  time.Duration
+	}{
+		{
+			name:  "no children",
+			spans: []testSpan{{name: "root", start: 0, end: 100}},
+			want:  100,
+		},
+		{
+			name: "overlapping children are counted once",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "a", parent: "root", start: 10, end: 50},
+				{name: "b", parent: "root", start: 30, end: 60},
+				{name: "c", parent: "root", start: 70, end: 80},
+			},
+			want: 40,
+		},
+		{
+			name: "children are clipped to the span",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "early", parent: "root", start: 0, end: 20},
+				{name: "late", parent: "root", start: 90, end: 200},
+			},
+			want: 70,
+		},
+		{
+			name:  "inverted timestamps",
+			spans: []testSpan{{name: "root", start: 100, end: 50}},
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := BuildTree(buildFixture(t, tt.spans...))
+			if got := SelfTime(tree.Node(testSpanID("root"))); got != tt.want {
+				t.Errorf("SelfTime = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package otlp
+
+// ExceptionEventName is the name of span events recording exceptions
+const ExceptionEventName = "exception"
+
+// Exception is an exception recorded as a span event following the OTel
+// semantic conventions
+type Exception struct {
+	Type         string
+	Message      string
+	Stacktrace   string
+	TimeUnixNano uint64
+}
+
+// ErrorNode is a span with an error status within the span tree
+type ErrorNode struct {
+	*Node
+	// Leaf is true when none of the span's descendants failed as well, which
+	// makes it the likely origin of the error
+	Leaf       bool
+	Exceptions []Exception
+}
+
+// ErrorSpans returns the spans of the tree with an error status in tree order
+func ErrorSpans(tree *Tree) []ErrorNode {
+	var errors []ErrorNode
+	tree.Walk(func(node *Node, depth int) bool {
+		if node.Span.IsError() {
+			errors = append(errors, ErrorNode{
+				Node:       node,
+				Leaf:       !hasErrorDescendant(node),
+				Exceptions: Exceptions(node.Span),
+			})
+		}
+		return true
+	})
+	return errors
+}
+
+// Exceptions returns the exception events recorded on the span
+func Exceptions(span *Span) []Exception {
+	var exceptions []Exception
+	for i := range span.Events {
+		event := &span.Events[i]
+		if event.Name != ExceptionEventName {
+			continue
+		}
+		exception := Exception{TimeUnixNano: event.TimeUnixNano}
+		if v, ok := event.Attribute("exception.type"); ok {
+			exception.Type = v.String()
+		}
+		if v, ok := event.Attribute("exception.message"); ok {
+			exception.Message = v.String()
+		}
+		if v, ok := event.Attribute("exception.stacktrace"); ok {
+			exception.Stacktrace = v.String()
+		}
+		exceptions = append(exceptions, exception)
+	}
+	return exceptions
+}
+
+// hasErrorDescendant reports whether any descendant of the node has an error status
+func hasErrorDescendant(node *Node) bool {
+	for _, child := range node.Children {
+		if child.Span.IsError() || hasErrorDescendant(child) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package otlp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExceptions(t *testing.T) {
+	trace := parseFixture(t, `{"batches": [{"scopeSpans": [{"spans": [{
+		"spanId": "AQEBAQEBAQE=", "name": "charge", "status": {"code": 2, "message": "card declined"},
+		"events": [
+			{"timeUnixNano": "100", "name": "exception", "attributes": [
+				{"key": "exception.type", "value": {"stringValue": "CardError"}},
+				{"key": "exception.message", "value": {"stringValue": "card declined"}},
+				{"key": "exception.stacktrace", "value": {"stringValue": "at charge()\nat main()"}}
+			]},
+			{"timeUnixNano": "150", "name": "retry"},
+			{"timeUnixNano": "200", "name": "exception", "attributes": [
+				{"key": "exception.type", "value": {"stringValue": "TimeoutError"}},
+				{"key": "exception.escaped", "value": {"boolValue": true}}
+			]},
+			{"timeUnixNano": "300", "name": "exception", "attributes": [
+				{"key": "exception.message", "value": {"intValue": "42"}}
+			]}
+		]
+	}]}]}]}`)
+
+	want := []Exception{
+		{Type: "CardError", Message: "card declined", Stacktrace: "at charge()\nat main()", TimeUnixNano: 100},
+		{Type: "TimeoutError", TimeUnixNano: 200},
+		{Message: "42", TimeUnixNano: 300},
+	}
+	if got := Exceptions(trace.Spans()[0]); !reflect.DeepEqual(got, want) {
+		t.Errorf("Exceptions = %+v, want %+v", got, want)
+	}
+}
+
+func TestExceptionsNone(t *testing.T) {
+	span := &Span{Events: []Event{{Name: "log"}}}
+	if got := Exceptions(span); len(got) != 0 {
+		t.Errorf("Exceptions = %+v, want none", got)
+	}
+}
+
+func TestErrorSpans(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []testSpan
+		// want lists the failed spans in tree order, with a * marking leaves
+		want []string
+	}{
+		{
+			name: "no errors",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "child", parent: "root", start: 10, end: 20},
+			},
+			want: nil,
+		},
+		{
+			name: "error propagated to the root",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100, failed: true},
+				{name: "mid", parent: "root", start: 10, end: 90, failed: true},
+				{name: "db", parent: "mid", start: 20, end: 30, failed: true},
+			},
+			want: []string{"root", "mid", "db*"},
+		},
+		{
+			name: "error origin below a healthy span",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100, failed: true},
+				{name: "retry", parent: "root", start: 10, end: 90},
+				{name: "db", parent: "retry", start: 20, end: 30, failed: true},
+			},
+			want: []string{"root", "db*"},
+		},
+		{
+			name: "independent failures",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "a", parent: "root", start: 10, end: 20, failed: true},
+				{name: "b", parent: "root", start: 30, end: 40, failed: true},
+				{name: "orphan", parent: "missing", start: 50, end: 60, failed: true},
+			},
+			want: []string{"a*", "b*", "orphan*"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, node := range ErrorSpans(BuildTree(buildFixture(t, tt.spans...))) {
+				name := node.Span.Name
+				if node.Leaf {
+					name += "*"
+				}
+				got = append(got, name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ErrorSpans = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// Package otlp contains a typed model of the OTLP/JSON trace payloads returned
+// by Tempo's trace by ID endpoints, shared by the trace formatters and analyses.
+package otlp
+
+import (
+	"sort"
+	"time"
+)
+
+// Trace is a parsed trace: the resource spans it consists of, plus an index
+// of all spans for convenient traversal
+type Trace struct {
+	ResourceSpans []*ResourceSpans `json:"resourceSpans"`
+
+	// Issues describes the invalid span fields found while parsing. They do
+	// not fail the trace: invalid IDs are kept as sent, invalid links are
+	// dropped and invalid timestamps are replaced.
+	Issues []string `json:"-"`
+
+	spans []*Span
+}
+
+// ResourceSpans groups the spans emitted by a single resource (e.g. a service instance)
+type ResourceSpans struct {
+	Resource   Resource      `json:"resource"`
+	ScopeSpans []*ScopeSpans `json:"scopeSpans"`
+}
+
+// Resource describes the entity producing the spans
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeSpans groups the spans emitted by a single instrumentation scope
+type ScopeSpans struct {
+	Scope Scope   `json:"scope"`
+	Spans []*Span `json:"spans"`
+}
+
+// Scope identifies the instrumentation library that produced the spans
+type Scope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Span is a single operation within a trace. IDs are normalized to lowercase hex.
+type Span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano uint64     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   uint64     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Events            []Event    `json:"events,omitempty"`
+	Links             []Link     `json:"links,omitempty"`
+	Status            Status     `json:"status"`
+
+	// Resource and Scope point back to the groups containing the span
+	Resource *Resource `json:"-"`
+	Scope    *Scope    `json:"-"`
+}
+
+// Event is a time-stamped annotation on a span, e.g. a recorded exception
+type Event struct {
+	TimeUnixNano uint64     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []KeyValue `json:"attributes,omitempty"`
+}
+
+// Link references a span in the same or another trace
+type Link struct {
+	TraceID    string     `json:"traceId"`
+	SpanID     string     `json:"spanId"`
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// Status is the outcome of a span
+type Status struct {
+	Code    StatusCode `json:"code"`
+	Message string     `json:"message,omitempty"`
+}
+
+// KeyValue is a single attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue is an attribute value. Exactly one of the fields is set.
+type AnyValue struct {
+	StringValue *string    `json:"stringValue,omitempty"`
+	BoolValue   *bool      `json:"boolValue,omitempty"`
+	IntValue    *int64     `json:"intValue,omitempty"`
+	DoubleValue *float64   `json:"doubleValue,omitempty"`
+	BytesValue  []byte     `json:"bytesValue,omitempty"`
+	ArrayValue  []AnyValue `json:"arrayValue,omitempty"`
+	KvlistValue []KeyValue `json:"kvlistValue,omitempty"`
+}
+
+// Spans returns all spans of the trace ordered by start time
+func (t *Trace) Spans() []*Span {
+	return t.spans
+}
+
+// SpanByID returns the span with the given hex ID, or nil if there is none
+func (t *Trace) SpanByID(id string) *Span {
+	for _, span := range t.spans {
+		if span.SpanID == id {
+			return span
+		}
+	}
+	return nil
+}
+
+// Services returns the sorted, de-duplicated service names of the trace
+func (t *Trace) Services() []string {
+	seen := map[string]bool{}
+	var services []string
+	for _, span := range t.spans {
+		name := span.ServiceName()
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, name)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// Bounds returns the earliest span start and latest span end of the trace
+func (t *Trace) Bounds() (start, end time.Time) {
+	var minStart, maxEnd uint64
+	for i, span := range t.spans {
+		if i == 0 || span.StartTimeUnixNano < minStart {
+			minStart = span.StartTimeUnixNano
+		}
+		if span.EndTimeUnixNano > maxEnd {
+			maxEnd = span.EndTimeUnixNano
+		}
+	}
+	return unixNano(minStart), unixNano(maxEnd)
+}
+
+// Duration returns the wall-clock duration covered by the trace
+func (t *Trace) Duration() time.Duration {
+	start, end := t.Bounds()
+	return end.Sub(start)
+}
+
+// ServiceName returns the service.name resource attribute of the span
+func (s *Span) ServiceName() string {
+	if s.Resource != nil {
+		if v, ok := lookup(s.Resource.Attributes, "service.name"); ok {
+			return v.String()
+		}
+	}
+	return "unknown"
+}
+
+// Attribute returns the span attribute with the given key
+func (s *Span) Attribute(key string) (AnyValue, bool) {
+	return lookup(s.Attributes, key)
+}
+
+// StartTime returns the start time of the span
+func (s *Span) StartTime() time.Time {
+	return unixNano(s.StartTimeUnixNano)
+}
+
+// EndTime returns the end time of the span
+func (s *Span) EndTime() time.Time {
+	return unixNano(s.EndTimeUnixNano)
+}
+
+// Duration returns the duration of the span
+func (s *Span) Duration() time.Duration {
+	if s.EndTimeUnixNano < s.StartTimeUnixNano {
+		return 0
+	}
+	return time.Duration(s.EndTimeUnixNano - s.StartTimeUnixNano)
+}
+
+// IsError reports whether the span has an error status
+func (s *Span) IsError() bool {
+	return s.Status.Code == StatusCodeError
+}
+
+// Attribute returns the event attribute with the given key
+func (e *Event) Attribute(key string) (AnyValue, bool) {
+	return lookup(e.Attributes, key)
+}
+
+// lookup finds the attribute with the given key
+func lookup(attributes []KeyValue, key string) (AnyValue, bool) {
+	for _, kv := range attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return AnyValue{}, false
+}
+
+// unixNano converts nanoseconds since the epoch to a time.Time
+func unixNano(ns uint64) time.Time {
+	return time.Unix(0, int64(ns)).UTC()
+}
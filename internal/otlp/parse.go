@@ -0,0 +1,221 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// wireTrace covers the payload shapes of Tempo's trace endpoints: /api/traces
+// returns {"batches": [...]}, /api/v2/traces wraps {"trace": {"resourceSpans": [...]}}
+// and plain OTLP exports use {"resourceSpans": [...]}
+type wireTrace struct {
+	Batches       []wireResourceSpans `json:"batches"`
+	ResourceSpans []wireResourceSpans `json:"resourceSpans"`
+	Trace         *wireTrace          `json:"trace"`
+}
+
+type wireResourceSpans struct {
+	Resource   Resource         `json:"resource"`
+	ScopeSpans []wireScopeSpans `json:"scopeSpans"`
+	// Deprecated OTLP name still emitted by older Tempo versions
+	InstrumentationLibrarySpans []wireScopeSpans `json:"instrumentationLibrarySpans"`
+}
+
+type wireScopeSpans struct {
+	Scope                  *Scope     `json:"scope"`
+	InstrumentationLibrary *Scope     `json:"instrumentationLibrary"`
+	Spans                  []wireSpan `json:"spans"`
+}
+
+type wireSpan struct {
+	TraceID           string        `json:"traceId"`
+	SpanID            string        `json:"spanId"`
+	ParentSpanID      string        `json:"parentSpanId"`
+	Name              string        `json:"name"`
+	Kind              SpanKind      `json:"kind"`
+	StartTimeUnixNano wireTimestamp `json:"startTimeUnixNano"`
+	EndTimeUnixNano   wireTimestamp `json:"endTimeUnixNano"`
+	Attributes        []KeyValue    `json:"attributes"`
+	Events            []struct {
+		TimeUnixNano wireTimestamp `json:"timeUnixNano"`
+		Name         string        `json:"name"`
+		Attributes   []KeyValue    `json:"attributes"`
+	} `json:"events"`
+	Links []struct {
+		TraceID    string     `json:"traceId"`
+		SpanID     string     `json:"spanId"`
+		Attributes []KeyValue `json:"attributes"`
+	} `json:"links"`
+	Status Status `json:"status"`
+}
+
+// wireTimestamp is a nanosecond timestamp that keeps an invalid value instead
+// of failing to decode, so that it can be reported as an issue of its span
+type wireTimestamp struct {
+	value   uint64
+	invalid string
+}
+
+func (t *wireTimestamp) UnmarshalJSON(data []byte) error {
+	var value flexUint64
+	if err := value.UnmarshalJSON(data); err != nil {
+		t.invalid = string(data)
+		return nil
+	}
+	t.value = uint64(value)
+	return nil
+}
+
+// Parse decodes a trace payload returned by Tempo. Invalid span fields do not
+// fail the trace but are reported in its Issues.
+func Parse(data []byte) (*Trace, error) {
+	var wire wireTrace
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, fmt.Errorf("failed to parse trace: %v", err)
+	}
+	for wire.Trace != nil {
+		wire = *wire.Trace
+	}
+
+	batches := wire.ResourceSpans
+	if len(batches) == 0 {
+		batches = wire.Batches
+	}
+
+	trace := &Trace{}
+	for _, wrs := range batches {
+		rs := &ResourceSpans{Resource: wrs.Resource}
+		scopes := wrs.ScopeSpans
+		if len(scopes) == 0 {
+			scopes = wrs.InstrumentationLibrarySpans
+		}
+
+		for _, wss := range scopes {
+			ss := &ScopeSpans{}
+			if wss.Scope != nil {
+				ss.Scope = *wss.Scope
+			} else if wss.InstrumentationLibrary != nil {
+				ss.Scope = *wss.InstrumentationLibrary
+			}
+
+			for _, ws := range wss.Spans {
+				span, issues := convertSpan(ws)
+				trace.Issues = append(trace.Issues, issues...)
+				span.Resource = &rs.Resource
+				span.Scope = &ss.Scope
+				ss.Spans = append(ss.Spans, span)
+				trace.spans = append(trace.spans, span)
+			}
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+		trace.ResourceSpans = append(trace.ResourceSpans, rs)
+	}
+
+	sort.SliceStable(trace.spans, func(i, j int) bool {
+		return trace.spans[i].StartTimeUnixNano < trace.spans[j].StartTimeUnixNano
+	})
+
+	return trace, nil
+}
+
+// convertSpan converts a decoded span into the model, normalizing its IDs. It
+// returns the issues found with the span's fields: IDs that cannot be
+// normalized are kept as sent, links with invalid IDs are dropped and invalid
+// timestamps are replaced by the span's other timestamp. An all-zero parent
+// span ID, as sent by some exporters, marks a root span.
+func convertSpan(ws wireSpan) (*Span, []string) {
+	span := &Span{
+		Name:              ws.Name,
+		Kind:              ws.Kind,
+		StartTimeUnixNano: ws.StartTimeUnixNano.value,
+		EndTimeUnixNano:   ws.EndTimeUnixNano.value,
+		Attributes:        ws.Attributes,
+		Status:            ws.Status,
+	}
+
+	var issues []string
+	flag := func(format string, args ...any) {
+		issues = append(issues, fmt.Sprintf("span %q (%s): ", ws.Name, ws.SpanID)+fmt.Sprintf(format, args...))
+	}
+
+	var err error
+	if span.TraceID, err = NormalizeID(ws.TraceID, 16); err != nil {
+		span.TraceID = ws.TraceID
+		flag("invalid trace ID %q: %v", ws.TraceID, err)
+	}
+	if span.SpanID, err = NormalizeID(ws.SpanID, 8); err != nil {
+		span.SpanID = ws.SpanID
+		flag("invalid span ID: %v", err)
+	}
+	if span.ParentSpanID, err = NormalizeID(ws.ParentSpanID, 8); err != nil {
+		span.ParentSpanID = ws.ParentSpanID
+		flag("invalid parent span ID %q: %v", ws.ParentSpanID, err)
+	} else if strings.Trim(span.ParentSpanID, "0") == "" {
+		span.ParentSpanID = ""
+	}
+
+	switch start, end := ws.StartTimeUnixNano, ws.EndTimeUnixNano; {
+	case start.invalid != "" && end.invalid != "":
+		flag("invalid start time %s and end time %s", start.invalid, end.invalid)
+	case start.invalid != "":
+		span.StartTimeUnixNano = span.EndTimeUnixNano
+		flag("invalid start time %s, using the end time", start.invalid)
+	case end.invalid != "":
+		span.EndTimeUnixNano = span.StartTimeUnixNano
+		flag("invalid end time %s, using the start time", end.invalid)
+	}
+
+	for _, we := range ws.Events {
+		event := Event{
+			TimeUnixNano: we.TimeUnixNano.value,
+			Name:         we.Name,
+			Attributes:   we.Attributes,
+		}
+		if we.TimeUnixNano.invalid != "" {
+			event.TimeUnixNano = span.StartTimeUnixNano
+			flag("invalid time %s of event %q, using the span start time", we.TimeUnixNano.invalid, we.Name)
+		}
+		span.Events = append(span.Events, event)
+	}
+
+	for _, wl := range ws.Links {
+		link := Link{Attributes: wl.Attributes}
+		if link.TraceID, err = NormalizeID(wl.TraceID, 16); err != nil {
+			flag("dropped link with invalid trace ID %q: %v", wl.TraceID, err)
+			continue
+		}
+		if link.SpanID, err = NormalizeID(wl.SpanID, 8); err != nil {
+			flag("dropped link with invalid span ID %q: %v", wl.SpanID, err)
+			continue
+		}
+		span.Links = append(span.Links, link)
+	}
+
+	return span, issues
+}
+
+// NormalizeID converts a trace or span ID of the given byte size to lowercase
+// hex. Tempo encodes IDs as base64 following the protobuf JSON mapping, while
+// the OTLP/JSON specification uses hex; both are accepted.
+func NormalizeID(id string, size int) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	if len(id) == size*2 {
+		if _, err := hex.DecodeString(id); err == nil {
+			return strings.ToLower(id), nil
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) != size {
+		return "", fmt.Errorf("expected %d bytes, got %d", size, len(raw))
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,238 @@
+package otlp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseFixture parses an OTLP/JSON fixture, failing the test on errors
+func parseFixture(t *testing.T, data string) *Trace {
+	t.Helper()
+	trace, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return trace
+}
+
+func TestNormalizeID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		size int
+		want string
+	}{
+		{"empty", "", 8, ""},
+		{"hex span ID", "0102030405060708", 8, "0102030405060708"},
+		{"uppercase hex", "AABBCCDDEEFF0011", 8, "aabbccddeeff0011"},
+		{"hex trace ID", "000102030405060708090a0b0c0d0e0f", 16, "000102030405060708090a0b0c0d0e0f"},
+		{"base64 span ID", "AQIDBAUGBwg=", 8, "0102030405060708"},
+		{"base64 trace ID", "AAECAwQFBgcICQoLDA0ODw==", 16, "000102030405060708090a0b0c0d0e0f"},
+		{"base64 of hex length", "qqqqqqqqqqo=", 8, "aaaaaaaaaaaaaaaa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeID(tt.id, tt.size)
+			if err != nil {
+				t.Fatalf("NormalizeID(%q): %v", tt.id, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeID(%q) = %q, want %q", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIDInvalid(t *testing.T) {
+	for _, id := range []string{"not an id!", "zz02030405060708", "AQID", "0102"} {
+		if got, err := NormalizeID(id, 8); err == nil {
+			t.Errorf("NormalizeID(%q) = %q, want error", id, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"tempo v1 batches with base64 IDs", `{"batches": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+			"scopeSpans": [{"scope": {"name": "lib"}, "spans": [
+				{"traceId": "AAECAwQFBgcICQoLDA0ODw==", "spanId": "AgICAgICAgI=", "parentSpanId": "AQEBAQEBAQE=",
+				 "name": "child", "kind": "SPAN_KIND_CLIENT", "startTimeUnixNano": "2000", "endTimeUnixNano": "3000"},
+				{"traceId": "AAECAwQFBgcICQoLDA0ODw==", "spanId": "AQEBAQEBAQE=",
+				 "name": "root", "kind": "SPAN_KIND_SERVER", "startTimeUnixNano": "1000", "endTimeUnixNano": "4000"}
+			]}]}]}`},
+		{"tempo v2 wrapped trace with hex IDs", `{"trace": {"resourceSpans": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+			"scopeSpans": [{"scope": {"name": "lib"}, "spans": [
+				{"traceId": "000102030405060708090A0B0C0D0E0F", "spanId": "0202020202020202", "parentSpanId": "0101010101010101",
+				 "name": "child", "kind": 3, "startTimeUnixNano": 2000, "endTimeUnixNano": 3000},
+				{"traceId": "000102030405060708090a0b0c0d0e0f", "spanId": "0101010101010101",
+				 "name": "root", "kind": 2, "startTimeUnixNano": 1000, "endTimeUnixNano": 4000}
+			]}]}]}}`},
+		{"deprecated instrumentation library spans", `{"resourceSpans": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+			"instrumentationLibrarySpans": [{"instrumentationLibrary": {"name": "lib"}, "spans": [
+				{"traceId": "AAECAwQFBgcICQoLDA0ODw==", "spanId": "0202020202020202", "parentSpanId": "AQEBAQEBAQE=",
+				 "name": "child", "kind": "SPAN_KIND_CLIENT", "startTimeUnixNano": "2000", "endTimeUnixNano": "3000"},
+				{"traceId": "AAECAwQFBgcICQoLDA0ODw==", "spanId": "AQEBAQEBAQE=",
+				 "name": "root", "kind": "SPAN_KIND_SERVER", "startTimeUnixNano": "1000", "endTimeUnixNano": "4000"}
+			]}]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := parseFixture(t, tt.data)
+
+			spans := trace.Spans()
+			if len(spans) != 2 {
+				t.Fatalf("Parse returned %d spans, want 2", len(spans))
+			}
+			root, child := spans[0], spans[1]
+			if root.Name != "root" || child.Name != "child" {
+				t.Fatalf("spans are not ordered by start time: %q, %q", root.Name, child.Name)
+			}
+			if root.TraceID != "000102030405060708090a0b0c0d0e0f" || root.SpanID != "0101010101010101" || root.ParentSpanID != "" {
+				t.Errorf("root IDs = %q %q %q", root.TraceID, root.SpanID, root.ParentSpanID)
+			}
+			if child.SpanID != "0202020202020202" || child.ParentSpanID != "0101010101010101" {
+				t.Errorf("child IDs = %q %q", child.SpanID, child.ParentSpanID)
+			}
+			if root.Kind != SpanKindServer || child.Kind != SpanKindClient {
+				t.Errorf("kinds = %v %v", root.Kind, child.Kind)
+			}
+			if child.StartTimeUnixNano != 2000 || child.EndTimeUnixNano != 3000 {
+				t.Errorf("child times = %d %d", child.StartTimeUnixNano, child.EndTimeUnixNano)
+			}
+			if root.ServiceName() != "api" || root.Scope.Name != "lib" {
+				t.Errorf("root service %q scope %q, want api and lib", root.ServiceName(), root.Scope.Name)
+			}
+			if got := trace.SpanByID("0202020202020202"); got != child {
+				t.Errorf("SpanByID returned %v, want the child", got)
+			}
+		})
+	}
+}
+
+func TestParseLinksAndEvents(t *testing.T) {
+	trace := parseFixture(t, `{"resourceSpans": [{"scopeSpans": [{"spans": [{
+		"traceId": "AAECAwQFBgcICQoLDA0ODw==", "spanId": "AQEBAQEBAQE=", "name": "op",
+		"events": [{"timeUnixNano": "1500", "name": "retry", "attributes": [{"key": "attempt", "value": {"intValue": "2"}}]}],
+		"links": [{"traceId": "0f0e0d0c0b0a09080706050403020100", "spanId": "AwMDAwMDAwM="}]
+	}]}]}]}`)
+
+	span := trace.Spans()[0]
+	wantLinks := []Link{{TraceID: "0f0e0d0c0b0a09080706050403020100", SpanID: "0303030303030303"}}
+	if !reflect.DeepEqual(span.Links, wantLinks) {
+		t.Errorf("links = %+v, want %+v", span.Links, wantLinks)
+	}
+	if len(span.Events) != 1 || span.Events[0].TimeUnixNano != 1500 {
+		t.Fatalf("events = %+v", span.Events)
+	}
+	if attempt, ok := span.Events[0].Attribute("attempt"); !ok || attempt.Interface() != int64(2) {
+		t.Errorf("event attribute attempt = %v", attempt.Interface())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range []string{`<html>`, `{"batches": [{"scopeSpans": [{"spans": [{"name": 42}]}]}]}`} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want error", data)
+		}
+	}
+}
+
+func TestParseInvalidFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		span  string
+		check func(span *Span) bool
+		issue string
+	}{
+		{
+			name:  "invalid span ID is kept",
+			span:  `"spanId": "not an id!", "startTimeUnixNano": "1000", "endTimeUnixNano": "2000"`,
+			check: func(span *Span) bool { return span.SpanID == "not an id!" },
+			issue: "invalid span ID",
+		},
+		{
+			name:  "invalid parent span ID is kept",
+			span:  `"spanId": "AQEBAQEBAQE=", "parentSpanId": "%%"`,
+			check: func(span *Span) bool { return span.SpanID == "0101010101010101" && span.ParentSpanID == "%%" },
+			issue: `invalid parent span ID "%%"`,
+		},
+		{
+			name:  "invalid trace ID is kept",
+			span:  `"traceId": "xyz", "spanId": "AQEBAQEBAQE="`,
+			check: func(span *Span) bool { return span.TraceID == "xyz" },
+			issue: `invalid trace ID "xyz"`,
+		},
+		{
+			name:  "invalid start time",
+			span:  `"spanId": "AQEBAQEBAQE=", "startTimeUnixNano": "yesterday", "endTimeUnixNano": "2000"`,
+			check: func(span *Span) bool { return span.StartTimeUnixNano == 2000 && span.EndTimeUnixNano == 2000 },
+			issue: `invalid start time "yesterday"`,
+		},
+		{
+			name:  "invalid end time",
+			span:  `"spanId": "AQEBAQEBAQE=", "startTimeUnixNano": "1000", "endTimeUnixNano": -1`,
+			check: func(span *Span) bool { return span.StartTimeUnixNano == 1000 && span.EndTimeUnixNano == 1000 },
+			issue: "invalid end time -1",
+		},
+		{
+			name:  "invalid event time",
+			span:  `"spanId": "AQEBAQEBAQE=", "startTimeUnixNano": "1000", "events": [{"name": "retry", "timeUnixNano": "soon"}]`,
+			check: func(span *Span) bool { return len(span.Events) == 1 && span.Events[0].TimeUnixNano == 1000 },
+			issue: `invalid time "soon" of event "retry"`,
+		},
+		{
+			name: "link with invalid span ID is dropped",
+			span: `"spanId": "AQEBAQEBAQE=", "links": [
+				{"traceId": "0f0e0d0c0b0a09080706050403020100", "spanId": "AQID"},
+				{"traceId": "0f0e0d0c0b0a09080706050403020100", "spanId": "AwMDAwMDAwM="}]`,
+			check: func(span *Span) bool { return len(span.Links) == 1 && span.Links[0].SpanID == "0303030303030303" },
+			issue: `dropped link with invalid span ID "AQID"`,
+		},
+		{
+			name:  "link with invalid trace ID is dropped",
+			span:  `"spanId": "AQEBAQEBAQE=", "links": [{"traceId": "AQID", "spanId": "AwMDAwMDAwM="}]`,
+			check: func(span *Span) bool { return len(span.Links) == 0 },
+			issue: `dropped link with invalid trace ID "AQID"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := parseFixture(t, `{"batches": [{"scopeSpans": [{"spans": [{"name": "op", `+tt.span+`}]}]}]}`)
+			if len(trace.Spans()) != 1 {
+				t.Fatalf("Parse returned %d spans, want 1", len(trace.Spans()))
+			}
+			if span := trace.Spans()[0]; !tt.check(span) {
+				t.Errorf("unexpected span %+v", span)
+			}
+			if len(trace.Issues) != 1 || !strings.Contains(trace.Issues[0], tt.issue) || !strings.HasPrefix(trace.Issues[0], `span "op"`) {
+				t.Errorf("Issues = %q, want one issue of span op containing %q", trace.Issues, tt.issue)
+			}
+		})
+	}
+}
+
+func TestParseZeroParentSpanID(t *testing.T) {
+	for _, parent := range []string{"0000000000000000", "AAAAAAAAAAA="} {
+		trace := parseFixture(t, `{"batches": [{"scopeSpans": [{"spans": [
+			{"spanId": "AQEBAQEBAQE=", "parentSpanId": "`+parent+`", "name": "root"},
+			{"spanId": "AgICAgICAgI=", "parentSpanId": "AQEBAQEBAQE=", "name": "child"}
+		]}]}]}`)
+		if root := trace.SpanByID("0101010101010101"); root.ParentSpanID != "" {
+			t.Errorf("parent span ID %q = %q, want a root span", parent, root.ParentSpanID)
+		}
+		if len(trace.Issues) != 0 {
+			t.Errorf("parent span ID %q reported issues %q", parent, trace.Issues)
+		}
+		tree := BuildTree(trace)
+		if got := treeShape(tree); got != "root(child)" {
+			t.Errorf("tree = %q, want root(child)", got)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package otlp
+
+import "sort"
+
+// Node is a span within the parent/child hierarchy of a trace
+type Node struct {
+	Span     *Span
+	Parent   *Node
+	Children []*Node
+}
+
+// Tree is the span hierarchy of a trace. Spans whose parent is missing from
+// the trace (e.g. because it was not ingested yet) are treated as roots.
+type Tree struct {
+	Roots []*Node
+	// Duplicates are the spans whose ID was already used by an earlier span
+	// of the trace. They are placed under their own parent, but spans
+	// referring to the ID as their parent are children of the first span.
+	Duplicates []*Node
+
+	nodes map[string]*Node
+}
+
+// BuildTree links the spans of the trace by their parent span IDs. Roots and
+// children are ordered by start time.
+func BuildTree(trace *Trace) *Tree {
+	tree := &Tree{nodes: map[string]*Node{}}
+	spans := trace.Spans()
+
+	nodes := make([]*Node, len(spans))
+	for i, span := range spans {
+		nodes[i] = &Node{Span: span}
+		if _, ok := tree.nodes[span.SpanID]; ok {
+			tree.Duplicates = append(tree.Duplicates, nodes[i])
+			continue
+		}
+		tree.nodes[span.SpanID] = nodes[i]
+	}
+
+	// spans are already ordered by start time, so children are appended in order
+	for _, node := range nodes {
+		span := node.Span
+		parent, ok := tree.nodes[span.ParentSpanID]
+		if span.ParentSpanID == "" || !ok || parent.hasAncestor(node) {
+			tree.Roots = append(tree.Roots, node)
+			continue
+		}
+		node.Parent = parent
+		parent.Children = append(parent.Children, node)
+	}
+
+	sort.SliceStable(tree.Roots, func(i, j int) bool {
+		// True roots sort before orphaned spans
+		iOrphan, jOrphan := tree.Roots[i].Span.ParentSpanID != "", tree.Roots[j].Span.ParentSpanID != ""
+		if iOrphan != jOrphan {
+			return !iOrphan
+		}
+		return tree.Roots[i].Span.StartTimeUnixNano < tree.Roots[j].Span.StartTimeUnixNano
+	})
+
+	return tree
+}
+
+// Node returns the node of the first span with the given ID, or nil if there is none
+func (t *Tree) Node(spanID string) *Node {
+	return t.nodes[spanID]
+}
+
+// Walk visits all nodes depth-first in start time order. Returning false from
+// fn skips the children of the node.
+func (t *Tree) Walk(fn func(node *Node, depth int) bool) {
+	for _, root := range t.Roots {
+		root.walk(0, fn)
+	}
+}
+
+func (n *Node) walk(depth int, fn func(node *Node, depth int) bool) {
+	if !fn(n, depth) {
+		return
+	}
+	for _, child := range n.Children {
+		child.walk(depth+1, fn)
+	}
+}
+
+// hasAncestor reports whether other is the node itself or one of its
+// ancestors, which guards against cycles in malformed traces
+func (n *Node) hasAncestor(other *Node) bool {
+	for p := n; p != nil; p = p.Parent {
+		if p == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Ancestors returns the chain of ancestors of the node, starting with the root
+func (n *Node) Ancestors() []*Node {
+	var chain []*Node
+	for p := n.Parent; p != nil; p = p.Parent {
+		chain = append([]*Node{p}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,211 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSpan describes a span of a test fixture. Spans are identified by their
+// name, from which the span ID is derived.
+type testSpan struct {
+	name, parent string
+	start, end   uint64
+	failed       bool
+}
+
+// testSpanID derives the hex span ID of a test span from its name
+func testSpanID(name string) string {
+	if name == "" {
+		return ""
+	}
+	return hex.EncodeToString([]byte(fmt.Sprintf("%-8.8s", name)))
+}
+
+// buildFixture encodes the spans as an OTLP/JSON trace of a single service
+// and parses it
+func buildFixture(t *testing.T, spans ...testSpan) *Trace {
+	t.Helper()
+	var wire []map[string]any
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           "000102030405060708090a0b0c0d0e0f",
+			"spanId":            testSpanID(s.name),
+			"parentSpanId":      testSpanID(s.parent),
+			"name":              s.name,
+			"startTimeUnixNano": fmt.Sprint(s.start),
+			"endTimeUnixNano":   fmt.Sprint(s.end),
+		}
+		if s.failed {
+			span["status"] = map[string]any{"code": "STATUS_CODE_ERROR"}
+		}
+		wire = append(wire, span)
+	}
+	data, err := json.Marshal(map[string]any{"batches": []any{map[string]any{
+		"resource":   map[string]any{"attributes": []any{map[string]any{"key": "service.name", "value": map[string]any{"stringValue": "svc"}}}},
+		"scopeSpans": []any{map[string]any{"spans": wire}},
+	}}})
+	if err != nil {
+		t.Fatalf("failed to encode fixture: %v", err)
+	}
+	return parseFixture(t, string(data))
+}
+
+// treeShape renders the tree as "name(child child(grandchild))" lists of roots
+func treeShape(tree *Tree) string {
+	var shape func(node *Node) string
+	shape = func(node *Node) string {
+		if len(node.Children) == 0 {
+			return node.Span.Name
+		}
+		children := make([]string, 0, len(node.Children))
+		for _, child := range node.Children {
+			children = append(children, shape(child))
+		}
+		return node.Span.Name + "(" + strings.Join(children, " ") + ")"
+	}
+	roots := make([]string, 0, len(tree.Roots))
+	for _, root := range tree.Roots {
+		roots = append(roots, shape(root))
+	}
+	return strings.Join(roots, " ")
+}
+
+func TestBuildTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		spans []testSpan
+		want  string
+	}{
+		{
+			name:  "empty trace",
+			spans: nil,
+			want:  "",
+		},
+		{
+			name: "children ordered by start time",
+			spans: []testSpan{
+				{name: "root", start: 0, end: 100},
+				{name: "b", parent: "root", start: 50, end: 60},
+				{name: "a", parent: "root", start: 10, end: 20},
+				{name: "a1", parent: "a", start: 12, end: 15},
+			},
+			want: "root(a(a1) b)",
+		},
+		{
+			name: "orphans become roots after the true root",
+			spans: []testSpan{
+				{name: "orphan", parent: "missing", start: 0, end: 10},
+				{name: "root", start: 5, end: 100},
+				{name: "child", parent: "orphan", start: 1, end: 2},
+			},
+			want: "root orphan(child)",
+		},
+		{
+			name: "several true roots",
+			spans: []testSpan{
+				{name: "second", start: 20, end: 30},
+				{name: "first", start: 10, end: 40},
+			},
+			want: "first second",
+		},
+		{
+			name: "cycle is broken",
+			spans: []testSpan{
+				{name: "a", parent: "b", start: 0, end: 10},
+				{name: "b", parent: "a", start: 1, end: 5},
+			},
+			// a is linked to b first, so b becomes the root
+			want: "b(a)",
+		},
+		{
+			name: "self parent",
+			spans: []testSpan{
+				{name: "loop", parent: "loop", start: 0, end: 10},
+			},
+			want: "loop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := BuildTree(buildFixture(t, tt.spans...))
+			if got := treeShape(tree); got != tt.want {
+				t.Errorf("tree = %q, want %q", got, tt.want)
+			}
+			if len(tree.Duplicates) != 0 {
+				t.Errorf("tree has %d duplicates, want none", len(tree.Duplicates))
+			}
+		})
+	}
+}
+
+func TestBuildTreeDuplicateSpanIDs(t *testing.T) {
+	trace := buildFixture(t,
+		testSpan{name: "root", start: 0, end: 100},
+		testSpan{name: "dup", parent: "root", start: 10, end: 20},
+		testSpan{name: "dup", parent: "root", start: 30, end: 40},
+		testSpan{name: "child", parent: "dup", start: 35, end: 38},
+	)
+	first, second := trace.Spans()[1], trace.Spans()[2]
+
+	tree := BuildTree(trace)
+	if got, want := treeShape(tree), "root(dup(child) dup)"; got != want {
+		t.Errorf("tree = %q, want %q", got, want)
+	}
+
+	var visited []*Span
+	tree.Walk(func(node *Node, depth int) bool {
+		visited = append(visited, node.Span)
+		return true
+	})
+	if len(visited) != 4 {
+		t.Errorf("Walk visited %d spans, want every span once", len(visited))
+	}
+
+	if node := tree.Node(testSpanID("dup")); node == nil || node.Span != first {
+		t.Errorf("Node returned %v, want the first span with the ID", node)
+	}
+	if len(tree.Duplicates) != 1 || tree.Duplicates[0].Span != second {
+		t.Errorf("Duplicates = %v, want the second span", tree.Duplicates)
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	tree := BuildTree(buildFixture(t,
+		testSpan{name: "root", start: 0, end: 100},
+		testSpan{name: "mid", parent: "root", start: 10, end: 90},
+		testSpan{name: "leaf", parent: "mid", start: 20, end: 30},
+	))
+
+	var names []string
+	for _, node := range tree.Node(testSpanID("leaf")).Ancestors() {
+		names = append(names, node.Span.Name)
+	}
+	if want := []string{"root", "mid"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Ancestors = %v, want %v", names, want)
+	}
+	if ancestors := tree.Roots[0].Ancestors(); len(ancestors) != 0 {
+		t.Errorf("root has ancestors %v", ancestors)
+	}
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	tree := BuildTree(buildFixture(t,
+		testSpan{name: "root", start: 0, end: 100},
+		testSpan{name: "skipped", parent: "root", start: 10, end: 20},
+		testSpan{name: "hidden", parent: "skipped", start: 11, end: 12},
+		testSpan{name: "shown", parent: "root", start: 30, end: 40},
+	))
+
+	var visited []string
+	tree.Walk(func(node *Node, depth int) bool {
+		visited = append(visited, fmt.Sprintf("%s@%d", node.Span.Name, depth))
+		return node.Span.Name != "skipped"
+	})
+	if want := []string{"root@0", "skipped@1", "shown@1"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk visited %v, want %v", visited, want)
+	}
+}
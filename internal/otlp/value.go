@@ -0,0 +1,252 @@
+package otlp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SpanKind is the OTLP span kind
+type SpanKind int
+
+// Span kinds as defined by OTLP
+const (
+	SpanKindUnspecified SpanKind = iota
+	SpanKindInternal
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+var spanKindNames = map[SpanKind]string{
+	SpanKindUnspecified: "SPAN_KIND_UNSPECIFIED",
+	SpanKindInternal:    "SPAN_KIND_INTERNAL",
+	SpanKindServer:      "SPAN_KIND_SERVER",
+	SpanKindClient:      "SPAN_KIND_CLIENT",
+	SpanKindProducer:    "SPAN_KIND_PRODUCER",
+	SpanKindConsumer:    "SPAN_KIND_CONSUMER",
+}
+
+// String returns the short lowercase name of the kind, e.g. "server"
+func (k SpanKind) String() string {
+	name, ok := spanKindNames[k]
+	if !ok {
+		return strconv.Itoa(int(k))
+	}
+	return strings.ToLower(strings.TrimPrefix(name, "SPAN_KIND_"))
+}
+
+// UnmarshalJSON accepts both the enum name and its numeric value
+func (k *SpanKind) UnmarshalJSON(data []byte) error {
+	n, err := unmarshalEnum(data, "SPAN_KIND_", func(name string) (int, bool) {
+		for kind, kindName := range spanKindNames {
+			if kindName == name {
+				return int(kind), true
+			}
+		}
+		return 0, false
+	})
+	*k = SpanKind(n)
+	return err
+}
+
+// StatusCode is the OTLP span status code
+type StatusCode int
+
+// Status codes as defined by OTLP
+const (
+	StatusCodeUnset StatusCode = iota
+	StatusCodeOk
+	StatusCodeError
+)
+
+var statusCodeNames = map[StatusCode]string{
+	StatusCodeUnset: "STATUS_CODE_UNSET",
+	StatusCodeOk:    "STATUS_CODE_OK",
+	StatusCodeError: "STATUS_CODE_ERROR",
+}
+
+// String returns the short lowercase name of the status code, e.g. "error"
+func (c StatusCode) String() string {
+	name, ok := statusCodeNames[c]
+	if !ok {
+		return strconv.Itoa(int(c))
+	}
+	return strings.ToLower(strings.TrimPrefix(name, "STATUS_CODE_"))
+}
+
+// UnmarshalJSON accepts both the enum name and its numeric value
+func (c *StatusCode) UnmarshalJSON(data []byte) error {
+	n, err := unmarshalEnum(data, "STATUS_CODE_", func(name string) (int, bool) {
+		for code, codeName := range statusCodeNames {
+			if codeName == name {
+				return int(code), true
+			}
+		}
+		return 0, false
+	})
+	*c = StatusCode(n)
+	return err
+}
+
+// unmarshalEnum decodes a protobuf JSON enum given either as a number or as
+// its name, with or without the common prefix
+func unmarshalEnum(data []byte, prefix string, byName func(string) (int, bool)) (int, error) {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		return n, nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return 0, err
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, prefix) {
+		name = prefix + name
+	}
+	if n, ok := byName(name); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown enum value %q", name)
+}
+
+// String renders the value in a compact, human-readable form
+func (v AnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(*v.IntValue, 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+	case v.BytesValue != nil:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case v.ArrayValue != nil:
+		parts := make([]string, 0, len(v.ArrayValue))
+		for _, item := range v.ArrayValue {
+			parts = append(parts, item.String())
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case v.KvlistValue != nil:
+		parts := make([]string, 0, len(v.KvlistValue))
+		for _, kv := range v.KvlistValue {
+			parts = append(parts, kv.Key+"="+kv.Value.String())
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return ""
+}
+
+// Interface returns the value as a plain Go value suitable for JSON encoding
+func (v AnyValue) Interface() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		return *v.IntValue
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.BytesValue != nil:
+		return v.BytesValue
+	case v.ArrayValue != nil:
+		items := make([]interface{}, 0, len(v.ArrayValue))
+		for _, item := range v.ArrayValue {
+			items = append(items, item.Interface())
+		}
+		return items
+	case v.KvlistValue != nil:
+		return AttributeMap(v.KvlistValue)
+	}
+	return nil
+}
+
+// AttributeMap converts a list of attributes into a map of plain Go values
+func AttributeMap(attributes []KeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(attributes))
+	for _, kv := range attributes {
+		m[kv.Key] = kv.Value.Interface()
+	}
+	return m
+}
+
+// UnmarshalJSON decodes the OTLP/JSON encoding of AnyValue, in which 64-bit
+// integers are strings and arrays and key-value lists are wrapped in a
+// "values" object
+func (v *AnyValue) UnmarshalJSON(data []byte) error {
+	var wire struct {
+		StringValue *string    `json:"stringValue"`
+		BoolValue   *bool      `json:"boolValue"`
+		IntValue    *flexInt64 `json:"intValue"`
+		DoubleValue *float64   `json:"doubleValue"`
+		BytesValue  []byte     `json:"bytesValue"`
+		ArrayValue  *struct {
+			Values []AnyValue `json:"values"`
+		} `json:"arrayValue"`
+		KvlistValue *struct {
+			Values []KeyValue `json:"values"`
+		} `json:"kvlistValue"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	*v = AnyValue{
+		StringValue: wire.StringValue,
+		BoolValue:   wire.BoolValue,
+		DoubleValue: wire.DoubleValue,
+		BytesValue:  wire.BytesValue,
+	}
+	if wire.IntValue != nil {
+		n := int64(*wire.IntValue)
+		v.IntValue = &n
+	}
+	if wire.ArrayValue != nil {
+		v.ArrayValue = append([]AnyValue{}, wire.ArrayValue.Values...)
+	}
+	if wire.KvlistValue != nil {
+		v.KvlistValue = append([]KeyValue{}, wire.KvlistValue.Values...)
+	}
+	return nil
+}
+
+// flexInt64 decodes 64-bit integers encoded either as JSON numbers or strings
+type flexInt64 int64
+
+func (i *flexInt64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = flexInt64(n)
+	return nil
+}
+
+// flexUint64 decodes unsigned 64-bit integers encoded either as JSON numbers or strings
+type flexUint64 uint64
+
+func (i *flexUint64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = flexUint64(n)
+	return nil
+}
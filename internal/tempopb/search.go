@@ -0,0 +1,265 @@
+// Package tempopb implements the protobuf messages of Tempo's streaming
+// search API (tempopb.StreamingQuerier/Search) that the server uses. Only the
+// fields needed by the tools are encoded and decoded; unknown fields are skipped.
+package tempopb
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// StreamingSearchMethod is the full name of the server-streaming search RPC
+const StreamingSearchMethod = "/tempopb.StreamingQuerier/Search"
+
+// SearchRequest is tempopb.SearchRequest
+type SearchRequest struct {
+	Tags            map[string]string // 1
+	MinDurationMs   uint32            // 2
+	MaxDurationMs   uint32            // 3
+	Limit           uint32            // 4
+	Start           uint32            // 5
+	End             uint32            // 6
+	Query           string            // 8
+	SpansPerSpanSet uint32            // 9
+}
+
+// SearchResponse is tempopb.SearchResponse. Streamed responses contain the
+// traces found or updated since the previous response and the metrics of the
+// search so far.
+type SearchResponse struct {
+	Traces  []*TraceSearchMetadata
+	Metrics *SearchMetrics
+}
+
+// TraceSearchMetadata is tempopb.TraceSearchMetadata
+type TraceSearchMetadata struct {
+	TraceID           string
+	RootServiceName   string
+	RootTraceName     string
+	StartTimeUnixNano uint64
+	DurationMs        uint32
+	SpanSet           *SpanSet
+	SpanSets          []*SpanSet
+}
+
+// SpanSet is tempopb.SpanSet
+type SpanSet struct {
+	Spans      []*Span
+	Matched    uint32
+	Attributes []otlp.KeyValue
+}
+
+// Span is tempopb.Span
+type Span struct {
+	SpanID            string
+	Name              string
+	StartTimeUnixNano uint64
+	DurationNanos     uint64
+	Attributes        []otlp.KeyValue
+}
+
+// SearchMetrics is tempopb.SearchMetrics
+type SearchMetrics struct {
+	InspectedTraces uint32
+	InspectedBytes  uint64
+	TotalBlocks     uint32
+	CompletedJobs   uint32
+	TotalJobs       uint32
+	TotalBlockBytes uint64
+}
+
+// Marshal encodes the request in the protobuf wire format
+func (r *SearchRequest) Marshal() ([]byte, error) {
+	var b []byte
+
+	// Map entries are encoded as nested messages; sort them for stable output
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, r.Tags[k])
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	b = appendUint(b, 2, uint64(r.MinDurationMs))
+	b = appendUint(b, 3, uint64(r.MaxDurationMs))
+	b = appendUint(b, 4, uint64(r.Limit))
+	b = appendUint(b, 5, uint64(r.Start))
+	b = appendUint(b, 6, uint64(r.End))
+	b = appendString(b, 8, r.Query)
+	b = appendUint(b, 9, uint64(r.SpansPerSpanSet))
+	return b, nil
+}
+
+// Unmarshal decodes a response in the protobuf wire format
+func (r *SearchResponse) Unmarshal(data []byte) error {
+	*r = SearchResponse{}
+	return walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			trace := &TraceSearchMetadata{}
+			if err := trace.unmarshal(value); err != nil {
+				return err
+			}
+			r.Traces = append(r.Traces, trace)
+		case num == 2 && typ == protowire.BytesType:
+			r.Metrics = &SearchMetrics{}
+			return r.Metrics.unmarshal(value)
+		}
+		return nil
+	})
+}
+
+func (t *TraceSearchMetadata) unmarshal(data []byte) error {
+	return walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			t.TraceID = string(value)
+		case 2:
+			t.RootServiceName = string(value)
+		case 3:
+			t.RootTraceName = string(value)
+		case 4:
+			t.StartTimeUnixNano = scalar
+		case 5:
+			t.DurationMs = uint32(scalar)
+		case 6:
+			t.SpanSet = &SpanSet{}
+			return t.SpanSet.unmarshal(value)
+		case 7:
+			spanSet := &SpanSet{}
+			if err := spanSet.unmarshal(value); err != nil {
+				return err
+			}
+			t.SpanSets = append(t.SpanSets, spanSet)
+		}
+		return nil
+	})
+}
+
+func (s *SpanSet) unmarshal(data []byte) error {
+	return walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			span := &Span{}
+			if err := span.unmarshal(value); err != nil {
+				return err
+			}
+			s.Spans = append(s.Spans, span)
+		case 2:
+			s.Matched = uint32(scalar)
+		case 3:
+			kv, err := unmarshalKeyValue(value)
+			if err != nil {
+				return err
+			}
+			s.Attributes = append(s.Attributes, kv)
+		}
+		return nil
+	})
+}
+
+func (s *Span) unmarshal(data []byte) error {
+	return walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			s.SpanID = string(value)
+		case 2:
+			s.Name = string(value)
+		case 3:
+			s.StartTimeUnixNano = scalar
+		case 4:
+			s.DurationNanos = scalar
+		case 5:
+			kv, err := unmarshalKeyValue(value)
+			if err != nil {
+				return err
+			}
+			s.Attributes = append(s.Attributes, kv)
+		}
+		return nil
+	})
+}
+
+func (m *SearchMetrics) unmarshal(data []byte) error {
+	return walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			m.InspectedTraces = uint32(scalar)
+		case 2:
+			m.InspectedBytes = scalar
+		case 3:
+			m.TotalBlocks = uint32(scalar)
+		case 4:
+			m.CompletedJobs = uint32(scalar)
+		case 5:
+			m.TotalJobs = uint32(scalar)
+		case 6:
+			m.TotalBlockBytes = scalar
+		}
+		return nil
+	})
+}
+
+// walkFields calls fn for every field of a message. Length-delimited fields
+// are passed as value, varint and fixed-size fields as scalar.
+func walkFields(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf tag: %v", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var value []byte
+		var scalar uint64
+		switch typ {
+		case protowire.VarintType:
+			scalar, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			scalar, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			scalar = uint64(v)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("invalid protobuf field %d: %v", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, value, scalar); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendUint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
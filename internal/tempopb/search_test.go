@@ -0,0 +1,122 @@
+package tempopb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// wire decodes a hex string, ignoring the spaces that separate fields
+func wire(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+func TestSearchRequestMarshal(t *testing.T) {
+	req := &SearchRequest{
+		Tags:            map[string]string{"k": "v"},
+		MinDurationMs:   100,
+		Limit:           20,
+		Start:           1000,
+		End:             2000,
+		Query:           "{}",
+		SpansPerSpanSet: 3,
+	}
+
+	got, err := req.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := wire(t, ""+
+		"0a 06 0a016b 120176"+ // tags: map entry {1: "k", 2: "v"}
+		"10 64"+ // min_duration_ms: 100, max_duration_ms omitted
+		"20 14"+ // limit: 20
+		"28 e807"+ // start: 1000
+		"30 d00f"+ // end: 2000
+		"42 02 7b7d"+ // query: "{}"
+		"48 03") // spans_per_span_set: 3
+	if !bytes.Equal(got, want) {
+		t.Errorf("Marshal = %x, want %x", got, want)
+	}
+}
+
+func TestSearchRequestMarshalEmpty(t *testing.T) {
+	got, err := (&SearchRequest{}).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Marshal of an empty request = %x, want no fields", got)
+	}
+}
+
+func TestSearchResponseUnmarshal(t *testing.T) {
+	data := wire(t, ""+
+		"0a 35"+ // traces
+		/**/ "0a 01 74"+ // trace_id: "t"
+		/**/ "12 03 737663"+ // root_service_name: "svc"
+		/**/ "1a 01 72"+ // root_trace_name: "r"
+		/**/ "20 0a"+ // start_time_unix_nano: 10
+		/**/ "28 03"+ // duration_ms: 3
+		/**/ "3a 21"+ // span_sets
+		/*  */ "0a 13"+ // spans
+		/*    */ "0a 01 73"+ // span_id: "s"
+		/*    */ "12 01 6e"+ // name: "n"
+		/*    */ "18 05"+ // start_time_unix_nano: 5
+		/*    */ "20 07"+ // duration_nanos: 7
+		/*    */ "2a 07 0a0161 12021809"+ // attributes: {a: int 9}
+		/*  */ "10 02"+ // matched: 2
+		/*  */ "1a 08 0a0162 1203 0a0178"+ // attributes: {b: "x"}
+		/**/ "9806 01"+ // unknown field 99
+		"12 09"+ // metrics
+		/**/ "08 1e"+ // inspected_traces: 30
+		/**/ "10 8008"+ // inspected_bytes: 1024
+		/**/ "20 01"+ // completed_jobs: 1
+		/**/ "28 02") // total_jobs: 2
+
+	var resp SearchResponse
+	if err := resp.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	intValue, stringValue := int64(9), "x"
+	want := SearchResponse{
+		Traces: []*TraceSearchMetadata{{
+			TraceID:           "t",
+			RootServiceName:   "svc",
+			RootTraceName:     "r",
+			StartTimeUnixNano: 10,
+			DurationMs:        3,
+			SpanSets: []*SpanSet{{
+				Spans: []*Span{{
+					SpanID:            "s",
+					Name:              "n",
+					StartTimeUnixNano: 5,
+					DurationNanos:     7,
+					Attributes:        []otlp.KeyValue{{Key: "a", Value: otlp.AnyValue{IntValue: &intValue}}},
+				}},
+				Matched:    2,
+				Attributes: []otlp.KeyValue{{Key: "b", Value: otlp.AnyValue{StringValue: &stringValue}}},
+			}},
+		}},
+		Metrics: &SearchMetrics{InspectedTraces: 30, InspectedBytes: 1024, CompletedJobs: 1, TotalJobs: 2},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("Unmarshal = %+v, want %+v", resp, want)
+	}
+}
+
+func TestSearchResponseUnmarshalTruncated(t *testing.T) {
+	var resp SearchResponse
+	if err := resp.Unmarshal(wire(t, "0a 35 0a01")); err == nil {
+		t.Error("Unmarshal of a truncated message succeeded, want error")
+	}
+}
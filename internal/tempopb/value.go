@@ -0,0 +1,81 @@
+package tempopb
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/scottlepp/tempo-mcp-server/internal/otlp"
+)
+
+// unmarshalKeyValue decodes an opentelemetry.proto.common.v1.KeyValue
+func unmarshalKeyValue(data []byte) (otlp.KeyValue, error) {
+	var kv otlp.KeyValue
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			kv.Key = string(value)
+		case 2:
+			v, err := unmarshalAnyValue(value)
+			if err != nil {
+				return err
+			}
+			kv.Value = v
+		}
+		return nil
+	})
+	return kv, err
+}
+
+// unmarshalAnyValue decodes an opentelemetry.proto.common.v1.AnyValue
+func unmarshalAnyValue(data []byte) (otlp.AnyValue, error) {
+	var v otlp.AnyValue
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, scalar uint64) error {
+		switch num {
+		case 1:
+			s := string(value)
+			v.StringValue = &s
+		case 2:
+			b := scalar != 0
+			v.BoolValue = &b
+		case 3:
+			i := int64(scalar)
+			v.IntValue = &i
+		case 4:
+			f := math.Float64frombits(scalar)
+			v.DoubleValue = &f
+		case 5:
+			// ArrayValue { repeated AnyValue values = 1; }
+			v.ArrayValue = []otlp.AnyValue{}
+			return walkFields(value, func(num protowire.Number, typ protowire.Type, item []byte, scalar uint64) error {
+				if num != 1 {
+					return nil
+				}
+				itemValue, err := unmarshalAnyValue(item)
+				if err != nil {
+					return err
+				}
+				v.ArrayValue = append(v.ArrayValue, itemValue)
+				return nil
+			})
+		case 6:
+			// KeyValueList { repeated KeyValue values = 1; }
+			v.KvlistValue = []otlp.KeyValue{}
+			return walkFields(value, func(num protowire.Number, typ protowire.Type, item []byte, scalar uint64) error {
+				if num != 1 {
+					return nil
+				}
+				kv, err := unmarshalKeyValue(item)
+				if err != nil {
+					return err
+				}
+				v.KvlistValue = append(v.KvlistValue, kv)
+				return nil
+			})
+		case 7:
+			v.BytesValue = append([]byte{}, value...)
+		}
+		return nil
+	})
+	return v, err
+}